@@ -0,0 +1,37 @@
+// Package crdt implements state-based conflict-free replicated data types
+// that can be replicated by shipping their state between nodes.
+package crdt
+
+import "fmt"
+
+// StateCRDT is a state-based (convergent) replicated data type. Merge must be
+// commutative, associative and idempotent so that replicas which have seen
+// the same set of states converge regardless of delivery order or duplication.
+//
+// Implementations are not safe for concurrent use.
+type StateCRDT interface {
+	// Merge joins the state of other into the receiver and reports whether
+	// the receiver changed, that is whether other held anything it had not
+	// seen. Returns an error if other is not the same CRDT type as the
+	// receiver.
+	Merge(other StateCRDT) (changed bool, err error)
+
+	// Value returns the user-visible value of the CRDT. The value must not
+	// share memory with the CRDT, so that it stays valid after the caller
+	// stops holding the lock that guards the CRDT.
+	Value() any
+
+	// Equal reports whether other holds exactly the same state.
+	Equal(other StateCRDT) bool
+
+	// MarshalJSON encodes the full state for replication.
+	MarshalJSON() ([]byte, error)
+
+	// UnmarshalJSON replaces the state with one produced by MarshalJSON.
+	UnmarshalJSON(data []byte) error
+}
+
+// mismatchError returns the error reported when merging two different CRDT types.
+func mismatchError(dst, src StateCRDT) error {
+	return fmt.Errorf("crdt: cannot merge %T into %T", src, dst)
+}
@@ -0,0 +1,15 @@
+package crdt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// merge merges src into dst and returns whether dst changed.
+func merge(t *testing.T, dst, src StateCRDT) bool {
+	t.Helper()
+	changed, err := dst.Merge(src)
+	require.NoError(t, err)
+	return changed
+}
@@ -0,0 +1,225 @@
+package crdt
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Element is a JSON value in canonical form: no insignificant whitespace,
+// object keys sorted, integers as exact decimal digits however large, and
+// other numbers in their shortest float64 form. Two elements encoding the same
+// value are therefore equal as strings, whatever the formatting of the JSON
+// they were parsed from. The zero Element is not a valid JSON value.
+//
+// Numbers that are canonicalized through float64 must be within its range:
+// those too large for it, or too small to tell apart from zero, are rejected
+// with ErrNumberOutOfRange rather than rounded to infinity or zero.
+type Element string
+
+// ErrNumberOutOfRange is returned when parsing a number that is not an exact
+// integer and cannot be represented as a float64 without becoming infinite
+// or zero.
+var ErrNumberOutOfRange = errors.New("crdt: number out of float64 range")
+
+// maxExactExponent bounds the exponent of numbers that are checked for an
+// exact integer value. Numbers with larger exponents are canonicalized through
+// float64.
+const maxExactExponent = 1000
+
+// ParseElement returns the canonical form of the JSON value in data.
+func ParseElement(data []byte) (Element, error) {
+	// Decode numbers as json.Number so that integers beyond the precision
+	// of float64 are kept exact.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return "", fmt.Errorf("parse element: %w", err)
+	} else if _, err := dec.Token(); err != io.EOF {
+		return "", fmt.Errorf("parse element: invalid data after top-level value")
+	}
+	return canonical(v)
+}
+
+// NewElement returns the canonical JSON encoding of v.
+func NewElement(v any) (Element, error) {
+	// Round trip through the generic representation so that numbers and
+	// object keys are normalized however v encodes them.
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("encode element: %w", err)
+	}
+	return ParseElement(data)
+}
+
+// canonical encodes v, a value decoded by encoding/json into an interface
+// with numbers as json.Number, in canonical form. encoding/json already sorts
+// map keys and writes json.Number values verbatim.
+func canonical(v any) (Element, error) {
+	v, err := canonicalValue(v)
+	if err != nil {
+		return "", fmt.Errorf("encode element: %w", err)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", fmt.Errorf("encode element: %w", err)
+	}
+	return Element(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))), nil
+}
+
+// canonicalValue returns v with every number replaced by its canonical form.
+func canonicalValue(v any) (any, error) {
+	switch v := v.(type) {
+	case json.Number:
+		return canonicalNumber(v)
+	case []any:
+		for i, elem := range v {
+			elem, err := canonicalValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = elem
+		}
+	case map[string]any:
+		for key, elem := range v {
+			elem, err := canonicalValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = elem
+		}
+	}
+	return v, nil
+}
+
+// canonicalNumber returns the canonical form of a JSON number: the exact
+// decimal digits if its value is an integer, or else its shortest float64
+// form. Returns ErrNumberOutOfRange if the float64 form overflows, or
+// underflows to zero from a number that is not zero.
+func canonicalNumber(n json.Number) (json.Number, error) {
+	s := string(n)
+	if i, ok := new(big.Int).SetString(s, 10); ok {
+		return json.Number(i.String()), nil
+	}
+	if exactExponent(s) {
+		if r, ok := new(big.Rat).SetString(s); ok && r.IsInt() {
+			return json.Number(r.Num().String()), nil
+		}
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if errors.Is(err, strconv.ErrRange) || (f == 0 && !isZero(s)) {
+		return "", fmt.Errorf("%w: %s", ErrNumberOutOfRange, s)
+	} else if err != nil {
+		return "", err
+	}
+	buf, err := json.Marshal(f)
+	if err != nil {
+		return "", err
+	}
+	return json.Number(buf), nil
+}
+
+// isZero reports whether the JSON number s is zero, i.e. whether its digits
+// before the exponent, if any, are all zero.
+func isZero(s string) bool {
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.Trim(s, "-0.") == ""
+}
+
+// exactExponent reports whether the exponent of the JSON number s, if any,
+// is small enough to compute its exact value.
+func exactExponent(s string) bool {
+	i := strings.IndexAny(s, "eE")
+	if i < 0 {
+		return true
+	}
+	exp, err := strconv.Atoi(s[i+1:])
+	return err == nil && exp >= -maxExactExponent && exp <= maxExactExponent
+}
+
+// MustElement is like NewElement but panics if v cannot be encoded.
+func MustElement(v any) Element {
+	e, err := NewElement(v)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// MarshalJSON returns the canonical encoding of the element.
+func (e Element) MarshalJSON() ([]byte, error) {
+	if e == "" {
+		return nil, fmt.Errorf("encode element: empty element")
+	}
+	return []byte(e), nil
+}
+
+// UnmarshalJSON parses any JSON value into its canonical form.
+func (e *Element) UnmarshalJSON(data []byte) error {
+	v, err := ParseElement(data)
+	if err != nil {
+		return err
+	}
+	*e = v
+	return nil
+}
+
+// compareElements orders numbers before other values, numbers numerically and
+// other values by their canonical encoding.
+func compareElements(a, b Element) int {
+	aNum, bNum := a.isNumber(), b.isNumber()
+	switch {
+	case aNum && bNum:
+		if c := compareNumbers(string(a), string(b)); c != 0 {
+			return c
+		}
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	}
+	return strings.Compare(string(a), string(b))
+}
+
+// isNumber reports whether the element is a JSON number.
+func (e Element) isNumber() bool {
+	return e != "" && (e[0] == '-' || (e[0] >= '0' && e[0] <= '9'))
+}
+
+// compareNumbers compares two canonical JSON numbers exactly. Integers that
+// fit in an int64 are compared directly and other numbers by their float64
+// value, falling back to exact arithmetic when the float64 values tie.
+func compareNumbers(a, b string) int {
+	x, errX := strconv.ParseInt(a, 10, 64)
+	y, errY := strconv.ParseInt(b, 10, 64)
+	if errX == nil && errY == nil {
+		return cmp.Compare(x, y)
+	}
+
+	// Rounding to float64 preserves order, but may make distinct numbers
+	// equal.
+	f, _ := strconv.ParseFloat(a, 64)
+	g, _ := strconv.ParseFloat(b, 64)
+	if c := cmp.Compare(f, g); c != 0 || a == b {
+		return c
+	}
+	r, okR := new(big.Rat).SetString(a)
+	q, okQ := new(big.Rat).SetString(b)
+	if !okR || !okQ {
+		return 0
+	}
+	return r.Cmp(q)
+}
@@ -0,0 +1,78 @@
+package crdt
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseElement(t *testing.T) {
+	for _, tt := range []struct{ data, want string }{
+		{`1`, `1`},
+		{`1.0`, `1`},
+		{`1e3`, `1000`},
+		{` "a<b" `, `"a<b"`},
+		{`{"b": [1, {"d": 0, "c": 0}], "a": null}`, `{"a":null,"b":[1,{"c":0,"d":0}]}`},
+		{`-0`, `0`},
+		{`0.5`, `0.5`},
+		{`1.5e-7`, `1.5e-7`},
+		{`0.0e-400`, `0`},
+		{`5e-324`, `5e-324`},
+		{`9007199254740993`, `9007199254740993`},
+		{`12345678901234567890`, `12345678901234567890`},
+		{`1.2345678901234567890e19`, `12345678901234567890`},
+		{`1e21`, `1000000000000000000000`},
+		{`[9007199254740993, {"id": 9007199254740993}]`, `[9007199254740993,{"id":9007199254740993}]`},
+	} {
+		e, err := ParseElement([]byte(tt.data))
+		require.NoError(t, err)
+		require.Equal(t, Element(tt.want), e, "parse %s", tt.data)
+	}
+
+	_, err := ParseElement([]byte(`{`))
+	require.Error(t, err)
+	_, err = ParseElement([]byte(`1 2`))
+	require.Error(t, err)
+
+	// Numbers beyond the range of float64 are neither rounded to zero nor
+	// to infinity.
+	for _, data := range []string{`1e-400`, `-2.5e-400`, `1.5e2000`, `1e2000`} {
+		_, err = ParseElement([]byte(data))
+		require.ErrorIs(t, err, ErrNumberOutOfRange, "parse %s", data)
+	}
+}
+
+// Ensure integers beyond the precision of float64 stay distinct and ordered.
+func TestElement_LargeIntegers(t *testing.T) {
+	s := NewGSet()
+	for _, data := range []string{`12345678901234567890`, `9007199254740993`, `9007199254740992`, `1e400`, `-9007199254740993`, `0.5`} {
+		e, err := ParseElement([]byte(data))
+		require.NoError(t, err)
+		s.Add(e)
+	}
+	require.Equal(t, []Element{
+		`-9007199254740993`,
+		`0.5`,
+		`9007199254740992`,
+		`9007199254740993`,
+		`12345678901234567890`,
+		Element("1" + strings.Repeat("0", 400)),
+	}, s.Elements())
+}
+
+func TestElement_JSON(t *testing.T) {
+	var body struct {
+		Element Element `json:"element"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"element": {"y": 2, "x": 1}}`), &body))
+	require.Equal(t, MustElement(map[string]int{"x": 1, "y": 2}), body.Element)
+
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	require.Equal(t, `{"element":{"x":1,"y":2}}`, string(data))
+
+	_, err = json.Marshal(Element(""))
+	require.Error(t, err)
+}
@@ -0,0 +1,108 @@
+package crdt
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var _ StateCRDT = (*GCounter)(nil)
+
+// ErrNegativeDelta is returned when decrementing a grow-only counter.
+var ErrNegativeDelta = errors.New("crdt: negative delta on grow-only counter")
+
+// GCounter is a grow-only counter. Each node increments only its own entry
+// and merging takes the per-node maximum, so the sum of all entries never
+// decreases.
+type GCounter struct {
+	counts map[string]int
+}
+
+// NewGCounter returns a G-Counter with a value of zero.
+func NewGCounter() *GCounter {
+	return &GCounter{counts: make(map[string]int)}
+}
+
+// Increment adds delta to the entry owned by nodeID and returns the delta
+// state holding just that entry. Returns ErrNegativeDelta if delta is
+// negative, since that would break merging by maximum.
+func (c *GCounter) Increment(nodeID string, delta int) (*GCounter, error) {
+	if delta < 0 {
+		return nil, ErrNegativeDelta
+	}
+	c.counts[nodeID] += delta
+	return &GCounter{counts: map[string]int{nodeID: c.counts[nodeID]}}, nil
+}
+
+// Count returns the entry owned by nodeID.
+func (c *GCounter) Count(nodeID string) int {
+	return c.counts[nodeID]
+}
+
+// Sum returns the total of all entries.
+func (c *GCounter) Sum() int {
+	var sum int
+	for _, v := range c.counts {
+		sum += v
+	}
+	return sum
+}
+
+// Merge takes the per-node maximum of the receiver and other. Reports
+// whether any entry grew.
+func (c *GCounter) Merge(other StateCRDT) (bool, error) {
+	o, ok := other.(*GCounter)
+	if !ok {
+		return false, mismatchError(c, other)
+	}
+	var changed bool
+	for nodeID, v := range o.counts {
+		if c.counts[nodeID] < v {
+			c.counts[nodeID] = v
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// Value returns the sum of all entries.
+func (c *GCounter) Value() any {
+	return c.Sum()
+}
+
+// Equal reports whether other has the same entry for every node.
+// Missing entries are treated as zero.
+func (c *GCounter) Equal(other StateCRDT) bool {
+	o, ok := other.(*GCounter)
+	if !ok {
+		return false
+	}
+	for nodeID, v := range c.counts {
+		if o.counts[nodeID] != v {
+			return false
+		}
+	}
+	for nodeID, v := range o.counts {
+		if c.counts[nodeID] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalJSON encodes the counter as a JSON object of node ID to count.
+func (c *GCounter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.counts)
+}
+
+// UnmarshalJSON decodes a JSON object of node ID to count into the counter.
+func (c *GCounter) UnmarshalJSON(data []byte) error {
+	var counts map[string]int
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return err
+	}
+	if counts == nil {
+		counts = make(map[string]int)
+	}
+	c.counts = counts
+	return nil
+}
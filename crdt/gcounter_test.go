@@ -0,0 +1,62 @@
+package crdt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGCounter_Increment(t *testing.T) {
+	c := NewGCounter()
+	c.Increment("n1", 2)
+	c.Increment("n1", 3)
+	c.Increment("n2", 1)
+
+	require.Equal(t, 5, c.Count("n1"))
+	require.Equal(t, 6, c.Sum())
+	require.Equal(t, 6, c.Value())
+
+	// The delta holds only the updated entry.
+	delta, err := c.Increment("n2", 2)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"n2": 3}, delta.counts)
+
+	_, err = c.Increment("n1", -1)
+	require.ErrorIs(t, err, ErrNegativeDelta)
+	require.Equal(t, 8, c.Sum())
+}
+
+func TestGCounter_Merge(t *testing.T) {
+	a, b := NewGCounter(), NewGCounter()
+	a.Increment("n1", 3)
+	b.Increment("n1", 1)
+	b.Increment("n2", 4)
+
+	require.True(t, merge(t, a, b))
+	require.Equal(t, 3, a.Count("n1"), "merge should keep the larger entry")
+	require.Equal(t, 7, a.Sum())
+
+	// Merging is idempotent and commutative.
+	require.False(t, merge(t, a, b), "merging again should not change the counter")
+	require.True(t, merge(t, b, a))
+	require.True(t, a.Equal(b))
+
+	_, err := a.Merge(NewGSet())
+	require.Error(t, err)
+}
+
+func TestGCounter_JSON(t *testing.T) {
+	c := NewGCounter()
+	c.Increment("n1", 3)
+
+	data, err := c.MarshalJSON()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"n1": 3}`, string(data))
+
+	other := NewGCounter()
+	require.NoError(t, other.UnmarshalJSON([]byte(`{"n1": 3, "n2": 0}`)))
+	require.True(t, c.Equal(other), "missing entries should equal zero")
+
+	require.NoError(t, other.UnmarshalJSON([]byte(`null`)))
+	require.Equal(t, 0, other.Sum())
+}
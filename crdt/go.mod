@@ -0,0 +1,16 @@
+module github.com/project3/crdt
+
+go 1.21.1
+
+require (
+	github.com/jepsen-io/maelstrom/demo/go v0.0.0
+	github.com/stretchr/testify v1.8.4
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/jepsen-io/maelstrom/demo/go => ../maelstrom/demo/go
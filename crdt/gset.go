@@ -0,0 +1,122 @@
+package crdt
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+var _ StateCRDT = (*GSet)(nil)
+
+// GSet is a grow-only set of JSON values. Elements can be added but never
+// removed, and merging two sets takes their union. Elements are compared by
+// their canonical encoding.
+type GSet struct {
+	elements map[Element]struct{}
+
+	// digest caches the Merkle tree returned by Digest until the set changes.
+	digest *Digest
+}
+
+// NewGSet returns an empty G-Set.
+func NewGSet() *GSet {
+	return &GSet{elements: make(map[Element]struct{})}
+}
+
+// Add inserts element into the set, if it is not already present. Returns
+// the delta state holding just the added element, which is empty if element
+// was already present.
+func (s *GSet) Add(element Element) *GSet {
+	delta := NewGSet()
+	if s.insert(element) {
+		delta.insert(element)
+	}
+	return delta
+}
+
+// insert adds element if it is not already present. Returns true if the set
+// changed.
+func (s *GSet) insert(element Element) bool {
+	if _, ok := s.elements[element]; ok {
+		return false
+	}
+	s.elements[element] = struct{}{}
+	s.digest = nil
+	return true
+}
+
+// Contains reports whether element is in the set.
+func (s *GSet) Contains(element Element) bool {
+	_, ok := s.elements[element]
+	return ok
+}
+
+// Len returns the number of elements in the set.
+func (s *GSet) Len() int {
+	return len(s.elements)
+}
+
+// Elements returns the elements of the set in ascending order: numbers
+// first, ordered numerically, then every other value ordered by its
+// canonical encoding.
+func (s *GSet) Elements() []Element {
+	elements := make([]Element, 0, len(s.elements))
+	for element := range s.elements {
+		elements = append(elements, element)
+	}
+	slices.SortFunc(elements, compareElements)
+	return elements
+}
+
+// Merge adds every element of other to the set. Reports whether any of them
+// was missing.
+func (s *GSet) Merge(other StateCRDT) (bool, error) {
+	o, ok := other.(*GSet)
+	if !ok {
+		return false, mismatchError(s, other)
+	}
+	var changed bool
+	for element := range o.elements {
+		if s.insert(element) {
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// Value returns the elements of the set in the order of Elements.
+func (s *GSet) Value() any {
+	return s.Elements()
+}
+
+// Equal reports whether other contains exactly the same elements.
+func (s *GSet) Equal(other StateCRDT) bool {
+	o, ok := other.(*GSet)
+	if !ok || len(s.elements) != len(o.elements) {
+		return false
+	}
+	for element := range o.elements {
+		if !s.Contains(element) {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalJSON encodes the set as a JSON array in the order of Elements.
+func (s *GSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Elements())
+}
+
+// UnmarshalJSON decodes a JSON array of arbitrary values into the set.
+func (s *GSet) UnmarshalJSON(data []byte) error {
+	var elements []Element
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return err
+	}
+	s.elements = make(map[Element]struct{}, len(elements))
+	s.digest = nil
+	for _, element := range elements {
+		s.insert(element)
+	}
+	return nil
+}
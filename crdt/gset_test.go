@@ -0,0 +1,94 @@
+package crdt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// elements returns the elements encoding each of values.
+func elements(values ...any) []Element {
+	elements := make([]Element, len(values))
+	for i, v := range values {
+		elements[i] = MustElement(v)
+	}
+	return elements
+}
+
+func TestGSet_Add(t *testing.T) {
+	s := NewGSet()
+	s.Add(MustElement(1))
+	s.Add(MustElement(2))
+	s.Add(MustElement(1))
+
+	require.Equal(t, 2, s.Len())
+	require.True(t, s.Contains(MustElement(1)))
+	require.False(t, s.Contains(MustElement(3)))
+	require.ElementsMatch(t, elements(1, 2), s.Value())
+
+	// The delta holds only the newly added element.
+	require.Equal(t, elements(3), s.Add(MustElement(3)).Elements())
+	require.Equal(t, 0, s.Add(MustElement(3)).Len())
+}
+
+func TestGSet_Add_JSON(t *testing.T) {
+	s := NewGSet()
+	for _, data := range []string{
+		`"tag"`, `{"id": 1, "kind": "user"}`, `[1, 2]`, `null`, `true`,
+		// Equal to the values above in canonical form.
+		`{"kind":"user","id":1.0}`, `[1e0, 2]`,
+	} {
+		e, err := ParseElement([]byte(data))
+		require.NoError(t, err)
+		s.Add(e)
+	}
+	require.Equal(t, 5, s.Len())
+	require.True(t, s.Contains(MustElement(map[string]any{"id": 1, "kind": "user"})))
+
+	data, err := s.MarshalJSON()
+	require.NoError(t, err)
+	require.JSONEq(t, `["tag", [1, 2], null, true, {"id": 1, "kind": "user"}]`, string(data))
+}
+
+func TestGSet_Elements_Sorted(t *testing.T) {
+	s := NewGSet()
+	for _, v := range []any{"b", 10, -2.5, "a", 9, 1e21} {
+		s.Add(MustElement(v))
+	}
+	require.Equal(t, elements(-2.5, 9, 10, 1e21, "a", "b"), s.Elements())
+}
+
+func TestGSet_Merge(t *testing.T) {
+	a, b := NewGSet(), NewGSet()
+	a.Add(MustElement(1))
+	a.Add(MustElement(2))
+	b.Add(MustElement(2))
+	b.Add(MustElement("three"))
+
+	require.True(t, merge(t, a, b))
+	require.ElementsMatch(t, elements(1, 2, "three"), a.Elements())
+
+	// Merging is idempotent and commutative.
+	require.False(t, merge(t, a, b), "merging again should not change the set")
+	require.True(t, merge(t, b, a))
+	require.True(t, a.Equal(b))
+
+	_, err := a.Merge(NewGCounter())
+	require.Error(t, err)
+}
+
+func TestGSet_JSON(t *testing.T) {
+	s := NewGSet()
+	s.Add(MustElement(1))
+	s.Add(MustElement("a"))
+
+	data, err := s.MarshalJSON()
+	require.NoError(t, err)
+	require.JSONEq(t, `[1, "a"]`, string(data))
+
+	other := NewGSet()
+	require.NoError(t, other.UnmarshalJSON([]byte(`["a", 1, 1.0]`)))
+	require.True(t, s.Equal(other))
+
+	require.Error(t, other.UnmarshalJSON([]byte(`{"a": 1}`)))
+}
@@ -0,0 +1,177 @@
+package crdt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+)
+
+// Shape of the Merkle tree built by GSet.Digest. Every internal node has
+// digestFanout children and the leaves are digestDepth levels below the root.
+const (
+	digestFanout = 16
+	digestDepth  = 3
+	digestLeaves = digestFanout * digestFanout * digestFanout
+)
+
+// Hash is a 64-bit hash of a subtree of a Digest. The empty subtree hashes to
+// zero. Hashes are encoded as hex strings in JSON.
+type Hash uint64
+
+// MarshalText encodes the hash as a hex string.
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatUint(uint64(h), 16)), nil
+}
+
+// UnmarshalText decodes a hex string produced by MarshalText.
+func (h *Hash) UnmarshalText(text []byte) error {
+	v, err := strconv.ParseUint(string(text), 16, 64)
+	if err != nil {
+		return fmt.Errorf("parse hash: %w", err)
+	}
+	*h = Hash(v)
+	return nil
+}
+
+// Digest is a Merkle tree over the elements of a GSet. Elements are assigned
+// to a fixed set of leaves by the hash of their canonical encoding, so two
+// sets with the same elements have identical trees regardless of insertion
+// order, and sets that differ only in a few elements differ only along a few
+// paths.
+//
+// Nodes are addressed by level, with the root at level 0 and the leaves at
+// level Depth, and by index within the level.
+type Digest struct {
+	levels [][]Hash
+	leaves [][]Element
+}
+
+// Digest returns a Merkle tree over the current elements of the set. The tree
+// is built once and reused until the set changes, so callers must not modify
+// it.
+func (s *GSet) Digest() *Digest {
+	if s.digest == nil {
+		s.digest = s.buildDigest()
+	}
+	return s.digest
+}
+
+// buildDigest hashes every element of the set into a new Merkle tree.
+func (s *GSet) buildDigest() *Digest {
+	d := &Digest{leaves: make([][]Element, digestLeaves)}
+
+	leafHashes := make([][]Hash, digestLeaves)
+	for element := range s.elements {
+		h := elementHash(element)
+		i := int(h % digestLeaves)
+		d.leaves[i] = append(d.leaves[i], element)
+		leafHashes[i] = append(leafHashes[i], h)
+	}
+
+	// Hash the leaves, then every level above them up to the root.
+	d.levels = make([][]Hash, digestDepth+1)
+	d.levels[digestDepth] = make([]Hash, digestLeaves)
+	for i, hashes := range leafHashes {
+		slices.Sort(hashes)
+		d.levels[digestDepth][i] = combineHashes(hashes)
+	}
+	for level := digestDepth - 1; level >= 0; level-- {
+		below := d.levels[level+1]
+		d.levels[level] = make([]Hash, len(below)/digestFanout)
+		for i := range d.levels[level] {
+			d.levels[level][i] = combineHashes(below[i*digestFanout : (i+1)*digestFanout])
+		}
+	}
+	return d
+}
+
+// Depth returns the level of the leaves.
+func (d *Digest) Depth() int {
+	return digestDepth
+}
+
+// Root returns the hash of the whole tree.
+func (d *Digest) Root() Hash {
+	return d.levels[0][0]
+}
+
+// Hashes returns the hashes of the nodes at the given indices of a level.
+func (d *Digest) Hashes(level int, indices []int) ([]Hash, error) {
+	if level < 0 || level > digestDepth {
+		return nil, fmt.Errorf("digest level %d out of range", level)
+	}
+	hashes := make([]Hash, len(indices))
+	for i, index := range indices {
+		if index < 0 || index >= len(d.levels[level]) {
+			return nil, fmt.Errorf("digest index %d out of range on level %d", index, level)
+		}
+		hashes[i] = d.levels[level][index]
+	}
+	return hashes, nil
+}
+
+// Diff returns the indices of a level whose hashes differ from other, where
+// other holds the hashes of another tree at the same indices.
+func (d *Digest) Diff(level int, indices []int, other []Hash) ([]int, error) {
+	hashes, err := d.Hashes(level, indices)
+	if err != nil {
+		return nil, err
+	} else if len(other) != len(hashes) {
+		return nil, fmt.Errorf("digest diff: got %d hashes, want %d", len(other), len(hashes))
+	}
+
+	var diff []int
+	for i, h := range hashes {
+		if h != other[i] {
+			diff = append(diff, indices[i])
+		}
+	}
+	return diff, nil
+}
+
+// Children returns the indices on the next level of the children of the
+// nodes at the given indices.
+func (d *Digest) Children(indices []int) []int {
+	children := make([]int, 0, len(indices)*digestFanout)
+	for _, index := range indices {
+		for i := 0; i < digestFanout; i++ {
+			children = append(children, index*digestFanout+i)
+		}
+	}
+	return children
+}
+
+// Elements returns the elements stored in the given leaves.
+func (d *Digest) Elements(leaves []int) []Element {
+	var elements []Element
+	for _, i := range leaves {
+		if i >= 0 && i < len(d.leaves) {
+			elements = append(elements, d.leaves[i]...)
+		}
+	}
+	return elements
+}
+
+// elementHash returns the hash of the canonical encoding of element.
+func elementHash(element Element) Hash {
+	h := fnv.New64a()
+	h.Write([]byte(element))
+	return Hash(h.Sum64())
+}
+
+// combineHashes returns the hash of a list of hashes, or zero if every hash
+// in the list is zero.
+func combineHashes(hashes []Hash) Hash {
+	empty := true
+	h := fnv.New64a()
+	for _, v := range hashes {
+		empty = empty && v == 0
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(v)))
+	}
+	if empty {
+		return 0
+	}
+	return Hash(h.Sum64())
+}
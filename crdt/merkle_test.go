@@ -0,0 +1,67 @@
+package crdt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHash_JSON(t *testing.T) {
+	var h Hash
+	require.NoError(t, h.UnmarshalText([]byte("ff")))
+	require.Equal(t, Hash(255), h)
+
+	text, err := h.MarshalText()
+	require.NoError(t, err)
+	require.Equal(t, "ff", string(text))
+
+	require.Error(t, h.UnmarshalText([]byte("xyz")))
+}
+
+func TestGSet_Digest(t *testing.T) {
+	a, b := NewGSet(), NewGSet()
+	require.Equal(t, Hash(0), a.Digest().Root(), "empty set should hash to zero")
+
+	for i := 0; i < 100; i++ {
+		a.Add(MustElement(i))
+		b.Add(MustElement(99 - i))
+	}
+	require.Equal(t, a.Digest().Root(), b.Digest().Root(), "insertion order should not matter")
+
+	// The tree is reused until the set changes.
+	require.Same(t, a.Digest(), a.Digest())
+	before := b.Digest()
+	b.Add(MustElement(0))
+	require.Same(t, before, b.Digest(), "adding an existing element should keep the tree")
+
+	// Descending the trees finds the single leaf holding the extra element.
+	b.Add(MustElement(1000))
+	da, db := a.Digest(), b.Digest()
+	require.NotEqual(t, da.Root(), db.Root())
+
+	indices := []int{0}
+	for level := 0; level <= da.Depth(); level++ {
+		theirs, err := db.Hashes(level, indices)
+		require.NoError(t, err)
+		diff, err := da.Diff(level, indices, theirs)
+		require.NoError(t, err)
+		require.Len(t, diff, 1)
+
+		indices = diff
+		if level < da.Depth() {
+			indices = da.Children(diff)
+		}
+	}
+	require.Contains(t, db.Elements(indices), MustElement(1000))
+	require.NotContains(t, da.Elements(indices), MustElement(1000))
+}
+
+func TestDigest_Hashes(t *testing.T) {
+	d := NewGSet().Digest()
+	_, err := d.Hashes(d.Depth()+1, []int{0})
+	require.Error(t, err)
+	_, err = d.Hashes(1, []int{16})
+	require.Error(t, err)
+	_, err = d.Diff(0, []int{0}, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,302 @@
+package crdt
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+)
+
+var _ StateCRDT = (*ORSet)(nil)
+
+// ORSet is an observed-remove set. Every add tags the element with a unique
+// dot (node ID and per-node counter) and a remove only discards the dots it
+// has observed, so an add that is concurrent with a remove wins.
+//
+// Removed dots are not kept as tombstones. Instead, the set carries the causal
+// context of every dot it has seen: a dot that is missing from one side of a
+// merge but seen by that side was removed there and is dropped. The context is
+// a version vector plus a cloud of the dots seen beyond it, which lets Add and
+// Remove return small delta states that only cover the dots they touch.
+type ORSet struct {
+	clock   map[string]int
+	cloud   map[dot]struct{}
+	entries map[float64]map[dot]struct{}
+}
+
+// dot uniquely identifies a single add operation.
+type dot struct {
+	Node    string `json:"node"`
+	Counter int    `json:"counter"`
+}
+
+// compareDots orders dots by node ID, then by counter.
+func compareDots(a, b dot) int {
+	if a.Node != b.Node {
+		return strings.Compare(a.Node, b.Node)
+	}
+	return a.Counter - b.Counter
+}
+
+// NewORSet returns an empty OR-Set.
+func NewORSet() *ORSet {
+	return &ORSet{
+		clock:   make(map[string]int),
+		cloud:   make(map[dot]struct{}),
+		entries: make(map[float64]map[dot]struct{}),
+	}
+}
+
+// Add inserts element into the set with a new dot owned by nodeID. Any dots
+// already observed for element are replaced by the new one. Returns the delta
+// state holding the new dot, with the replaced dots in its context.
+func (s *ORSet) Add(nodeID string, element float64) *ORSet {
+	d := dot{Node: nodeID, Counter: s.clock[nodeID] + 1}
+
+	delta := NewORSet()
+	for old := range s.entries[element] {
+		delta.cloud[old] = struct{}{}
+	}
+	delta.cloud[d] = struct{}{}
+	delta.entries[element] = map[dot]struct{}{d: {}}
+	delta.compact()
+
+	s.clock[nodeID] = d.Counter
+	s.entries[element] = map[dot]struct{}{d: {}}
+	return delta
+}
+
+// Remove discards every observed dot of element. Returns the delta state
+// holding the discarded dots in its context, and false if element was not in
+// the set, in which case the delta is empty.
+func (s *ORSet) Remove(element float64) (*ORSet, bool) {
+	delta := NewORSet()
+	dots, ok := s.entries[element]
+	if !ok {
+		return delta, false
+	}
+	delete(s.entries, element)
+
+	for d := range dots {
+		delta.cloud[d] = struct{}{}
+	}
+	delta.compact()
+	return delta, true
+}
+
+// seen reports whether d is covered by the causal context of the set.
+func (s *ORSet) seen(d dot) bool {
+	if d.Counter <= s.clock[d.Node] {
+		return true
+	}
+	_, ok := s.cloud[d]
+	return ok
+}
+
+// compact moves the dots of the cloud that extend the version vector
+// without a gap into the vector.
+func (s *ORSet) compact() {
+	for d := range s.cloud {
+		if d.Counter <= s.clock[d.Node] {
+			delete(s.cloud, d)
+		}
+	}
+	for d := range s.cloud {
+		for {
+			next := dot{Node: d.Node, Counter: s.clock[d.Node] + 1}
+			if _, ok := s.cloud[next]; !ok {
+				break
+			}
+			s.clock[d.Node] = next.Counter
+			delete(s.cloud, next)
+		}
+	}
+}
+
+// Contains reports whether element is in the set.
+func (s *ORSet) Contains(element float64) bool {
+	_, ok := s.entries[element]
+	return ok
+}
+
+// Len returns the number of elements in the set.
+func (s *ORSet) Len() int {
+	return len(s.entries)
+}
+
+// Elements returns the elements of the set in ascending order.
+func (s *ORSet) Elements() []float64 {
+	elements := make([]float64, 0, len(s.entries))
+	for element := range s.entries {
+		elements = append(elements, element)
+	}
+	slices.Sort(elements)
+	return elements
+}
+
+// Merge joins other into the receiver. A dot survives if both sides have it,
+// or if one side has it and the other side has never seen it. Reports
+// whether any dot was added or dropped or the causal context grew.
+func (s *ORSet) Merge(other StateCRDT) (bool, error) {
+	o, ok := other.(*ORSet)
+	if !ok {
+		return false, mismatchError(s, other)
+	}
+
+	var changed bool
+	entries := make(map[float64]map[dot]struct{})
+	for element, dots := range s.entries {
+		kept, dotsChanged := mergeDots(dots, o.entries[element], s, o)
+		if len(kept) > 0 {
+			entries[element] = kept
+		}
+		changed = changed || dotsChanged
+	}
+	for element, dots := range o.entries {
+		if _, ok := s.entries[element]; ok {
+			continue // already merged above
+		}
+		kept, dotsChanged := mergeDots(nil, dots, s, o)
+		if len(kept) > 0 {
+			entries[element] = kept
+		}
+		changed = changed || dotsChanged
+	}
+	s.entries = entries
+
+	for nodeID, counter := range o.clock {
+		if s.clock[nodeID] < counter {
+			s.clock[nodeID] = counter
+			changed = true
+		}
+	}
+	for d := range o.cloud {
+		if !s.seen(d) {
+			s.cloud[d] = struct{}{}
+			changed = true
+		}
+	}
+	s.compact()
+	return changed, nil
+}
+
+// mergeDots returns the dots of a single element that survive a merge of
+// the local dots and set with the remote dots and set. Reports whether the
+// surviving dots differ from the local ones.
+func mergeDots(mine, theirs map[dot]struct{}, me, them *ORSet) (kept map[dot]struct{}, changed bool) {
+	kept = make(map[dot]struct{})
+	for d := range mine {
+		if _, ok := theirs[d]; ok || !them.seen(d) {
+			kept[d] = struct{}{}
+		} else {
+			changed = true
+		}
+	}
+	for d := range theirs {
+		if _, ok := mine[d]; ok {
+			continue
+		} else if !me.seen(d) {
+			kept[d] = struct{}{}
+			changed = true
+		}
+	}
+	return kept, changed
+}
+
+// Value returns the elements of the set in ascending order.
+func (s *ORSet) Value() any {
+	return s.Elements()
+}
+
+// Equal reports whether other has the same elements, dots and causal
+// context.
+func (s *ORSet) Equal(other StateCRDT) bool {
+	o, ok := other.(*ORSet)
+	if !ok || !clocksEqual(s.clock, o.clock) || !maps.Equal(s.cloud, o.cloud) {
+		return false
+	}
+	return maps.EqualFunc(s.entries, o.entries, func(a, b map[dot]struct{}) bool {
+		return maps.Equal(a, b)
+	})
+}
+
+// clocksEqual reports whether two version vectors are equal, treating
+// missing entries as zero.
+func clocksEqual(a, b map[string]int) bool {
+	for nodeID, counter := range a {
+		if b[nodeID] != counter {
+			return false
+		}
+	}
+	for nodeID, counter := range b {
+		if a[nodeID] != counter {
+			return false
+		}
+	}
+	return true
+}
+
+// orSetJSON is the wire format of an ORSet.
+type orSetJSON struct {
+	Clock   map[string]int   `json:"clock"`
+	Cloud   []dot            `json:"cloud,omitempty"`
+	Entries []orSetEntryJSON `json:"entries"`
+}
+
+// orSetEntryJSON is the wire format of a single element and its dots.
+type orSetEntryJSON struct {
+	Element float64 `json:"element"`
+	Dots    []dot   `json:"dots"`
+}
+
+// MarshalJSON encodes the set as its causal context and a list of entries.
+func (s *ORSet) MarshalJSON() ([]byte, error) {
+	v := orSetJSON{
+		Clock:   s.clock,
+		Entries: make([]orSetEntryJSON, 0, len(s.entries)),
+	}
+	for d := range s.cloud {
+		v.Cloud = append(v.Cloud, d)
+	}
+	slices.SortFunc(v.Cloud, compareDots)
+	for _, element := range s.Elements() {
+		entry := orSetEntryJSON{Element: element}
+		for d := range s.entries[element] {
+			entry.Dots = append(entry.Dots, d)
+		}
+		slices.SortFunc(entry.Dots, compareDots)
+		v.Entries = append(v.Entries, entry)
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes a causal context and list of entries into the set.
+func (s *ORSet) UnmarshalJSON(data []byte) error {
+	var v orSetJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	s.clock = v.Clock
+	if s.clock == nil {
+		s.clock = make(map[string]int)
+	}
+	s.entries = make(map[float64]map[dot]struct{}, len(v.Entries))
+	for _, entry := range v.Entries {
+		if len(entry.Dots) == 0 {
+			continue
+		}
+		dots := make(map[dot]struct{}, len(entry.Dots))
+		for _, d := range entry.Dots {
+			dots[d] = struct{}{}
+		}
+		s.entries[entry.Element] = dots
+	}
+
+	s.cloud = make(map[dot]struct{}, len(v.Cloud))
+	for _, d := range v.Cloud {
+		s.cloud[d] = struct{}{}
+	}
+	s.compact()
+	return nil
+}
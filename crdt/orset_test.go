@@ -0,0 +1,220 @@
+package crdt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// syncORSets merges a and b into each other so both hold the same state.
+func syncORSets(t *testing.T, a, b *ORSet) {
+	t.Helper()
+	merge(t, a, b)
+	merge(t, b, a)
+	require.True(t, a.Equal(b))
+}
+
+// remove removes element from s and reports whether it was in the set.
+func remove(s *ORSet, element float64) bool {
+	_, ok := s.Remove(element)
+	return ok
+}
+
+func TestORSet_AddRemove(t *testing.T) {
+	s := NewORSet()
+	s.Add("n1", 1)
+	s.Add("n1", 2)
+	s.Add("n1", 1)
+	require.Equal(t, []float64{1, 2}, s.Value())
+
+	require.True(t, remove(s, 1))
+	require.False(t, remove(s, 1))
+	require.False(t, s.Contains(1))
+	require.Equal(t, []float64{2}, s.Elements())
+
+	s.Add("n1", 1)
+	require.True(t, s.Contains(1), "element can be re-added after removal")
+}
+
+func TestORSet_Merge(t *testing.T) {
+	t.Run("ObservedRemove", func(t *testing.T) {
+		a, b := NewORSet(), NewORSet()
+		a.Add("n1", 1)
+		syncORSets(t, a, b)
+
+		// b removes an add it has observed, so the removal propagates.
+		require.True(t, remove(b, 1))
+		syncORSets(t, a, b)
+		require.Equal(t, 0, a.Len())
+
+		// Merging a stale copy taken before the removal must not resurrect it.
+		stale := NewORSet()
+		stale.Add("n1", 1)
+		merge(t, a, stale)
+		require.False(t, a.Contains(1))
+	})
+
+	t.Run("ConcurrentAddWins", func(t *testing.T) {
+		a, b := NewORSet(), NewORSet()
+		a.Add("n1", 1)
+		syncORSets(t, a, b)
+
+		// a re-adds the element while b concurrently removes it.
+		a.Add("n1", 1)
+		require.True(t, remove(b, 1))
+		syncORSets(t, a, b)
+		require.Equal(t, []float64{1}, b.Elements())
+	})
+
+	t.Run("ConcurrentAddOnBothSides", func(t *testing.T) {
+		a, b := NewORSet(), NewORSet()
+		a.Add("n1", 1)
+		b.Add("n2", 1)
+		syncORSets(t, a, b)
+
+		// Removing on one side only discards the dots it has observed.
+		c := NewORSet()
+		merge(t, c, a)
+		a.Add("n1", 1)
+		require.True(t, remove(c, 1))
+		merge(t, b, c)
+		require.False(t, b.Contains(1))
+		syncORSets(t, a, b)
+		require.True(t, b.Contains(1))
+	})
+
+	t.Run("ConcurrentRemoveOnBothSides", func(t *testing.T) {
+		a, b := NewORSet(), NewORSet()
+		a.Add("n1", 1)
+		a.Add("n1", 2)
+		syncORSets(t, a, b)
+
+		require.True(t, remove(a, 1))
+		require.True(t, remove(b, 1))
+		b.Add("n2", 3)
+		syncORSets(t, a, b)
+		require.Equal(t, []float64{2, 3}, a.Elements())
+	})
+
+	t.Run("Commutative", func(t *testing.T) {
+		a, b := NewORSet(), NewORSet()
+		a.Add("n1", 1)
+		a.Add("n1", 2)
+		b.Add("n2", 2)
+		b.Add("n2", 3)
+		require.True(t, remove(b, 3))
+
+		ab, ba := NewORSet(), NewORSet()
+		merge(t, ab, a)
+		merge(t, ab, b)
+		merge(t, ba, b)
+		merge(t, ba, a)
+		require.True(t, ab.Equal(ba))
+
+		// Merging is idempotent.
+		merge(t, ab, b)
+		require.True(t, ab.Equal(ba))
+	})
+
+	t.Run("ErrMismatch", func(t *testing.T) {
+		_, err := NewORSet().Merge(NewGSet())
+		require.Error(t, err)
+	})
+}
+
+// Ensure shipping only deltas converges to the same state as shipping full
+// states.
+func TestORSet_Delta(t *testing.T) {
+	t.Run("AddRemove", func(t *testing.T) {
+		a, b := NewORSet(), NewORSet()
+		merge(t, b, a.Add("n1", 1))
+		merge(t, b, a.Add("n1", 2))
+		merge(t, b, a.Add("n1", 1))
+		require.True(t, a.Equal(b))
+
+		delta, ok := a.Remove(1)
+		require.True(t, ok)
+		require.Equal(t, 0, delta.Len())
+		require.True(t, merge(t, b, delta))
+		require.True(t, a.Equal(b))
+		require.Equal(t, []float64{2}, b.Elements())
+		require.False(t, merge(t, b, delta), "merging again should not change the set")
+
+		delta, ok = a.Remove(1)
+		require.False(t, ok)
+		require.True(t, delta.Equal(NewORSet()))
+	})
+
+	t.Run("OutOfOrder", func(t *testing.T) {
+		a, b := NewORSet(), NewORSet()
+		add1 := a.Add("n1", 1)
+		add2 := a.Add("n1", 2)
+		remove1, _ := a.Remove(1)
+
+		// The removal arrives before the add it removes, which must not be
+		// resurrected when the add arrives, and the gap is closed once it does.
+		require.True(t, merge(t, b, remove1), "a removal grows the causal context")
+		merge(t, b, add2)
+		require.False(t, merge(t, b, add1), "a removed add should not change the set")
+		require.True(t, a.Equal(b))
+		require.Equal(t, []float64{2}, b.Elements())
+		require.Empty(t, b.cloud)
+	})
+
+	t.Run("ConcurrentAddWins", func(t *testing.T) {
+		a, b := NewORSet(), NewORSet()
+		merge(t, b, a.Add("n1", 1))
+
+		// a re-adds the element while b concurrently removes it.
+		add := a.Add("n1", 1)
+		remove, _ := b.Remove(1)
+		merge(t, a, remove)
+		merge(t, b, add)
+		require.True(t, a.Equal(b))
+		require.Equal(t, []float64{1}, b.Elements())
+	})
+
+	t.Run("Join", func(t *testing.T) {
+		a, b := NewORSet(), NewORSet()
+		add := a.Add("n1", 1)
+		remove, _ := a.Remove(1)
+
+		// Deltas joined into a buffer before shipping keep the removal.
+		joined := NewORSet()
+		merge(t, joined, add)
+		merge(t, joined, remove)
+		merge(t, b, joined)
+		require.True(t, a.Equal(b))
+		require.False(t, b.Contains(1))
+	})
+}
+
+func TestORSet_JSON(t *testing.T) {
+	s := NewORSet()
+	s.Add("n1", 1)
+	s.Add("n2", 2)
+	s.Remove(2)
+
+	data, err := s.MarshalJSON()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"clock": {"n1": 1, "n2": 1}, "entries": [{"element": 1, "dots": [{"node": "n1", "counter": 1}]}]}`, string(data))
+
+	other := NewORSet()
+	require.NoError(t, other.UnmarshalJSON(data))
+	require.True(t, s.Equal(other))
+
+	delta, _ := s.Remove(1)
+	data, err = delta.MarshalJSON()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"clock": {"n1": 1}, "entries": []}`, string(data))
+
+	delta = s.Add("n2", 3)
+	data, err = delta.MarshalJSON()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"clock": {}, "cloud": [{"node": "n2", "counter": 2}], "entries": [{"element": 3, "dots": [{"node": "n2", "counter": 2}]}]}`, string(data))
+	require.NoError(t, other.UnmarshalJSON(data))
+	require.True(t, delta.Equal(other))
+
+	require.NoError(t, other.UnmarshalJSON([]byte(`{}`)))
+	require.Equal(t, 0, other.Len())
+}
@@ -0,0 +1,108 @@
+package crdt
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+)
+
+var _ StateCRDT = (*PNCounter)(nil)
+
+// ErrDeltaOutOfRange is returned when adding a delta whose magnitude cannot
+// be represented as an int.
+var ErrDeltaOutOfRange = errors.New("crdt: delta out of range")
+
+// PNCounter is a counter that supports both increments and decrements. It is
+// made of two G-Counters: P accumulates increments and N accumulates
+// decrements, and its value is the difference of their sums.
+type PNCounter struct {
+	p *GCounter
+	n *GCounter
+}
+
+// NewPNCounter returns a PN-Counter with a value of zero.
+func NewPNCounter() *PNCounter {
+	return &PNCounter{
+		p: NewGCounter(),
+		n: NewGCounter(),
+	}
+}
+
+// Add adds delta, which may be negative, to the entry owned by nodeID and
+// returns the delta state holding just the updated entry. Returns
+// ErrDeltaOutOfRange if delta is math.MinInt, since decrements are counted
+// by their magnitude.
+func (c *PNCounter) Add(nodeID string, delta int) (*PNCounter, error) {
+	if delta == math.MinInt {
+		return nil, ErrDeltaOutOfRange
+	}
+	d := NewPNCounter()
+	if delta < 0 {
+		c.n.counts[nodeID] -= delta
+		d.n.counts[nodeID] = c.n.counts[nodeID]
+	} else {
+		c.p.counts[nodeID] += delta
+		d.p.counts[nodeID] = c.p.counts[nodeID]
+	}
+	return d, nil
+}
+
+// Sum returns the total of all increments minus all decrements.
+func (c *PNCounter) Sum() int {
+	return c.p.Sum() - c.n.Sum()
+}
+
+// Merge merges the increments and decrements of other into the receiver.
+func (c *PNCounter) Merge(other StateCRDT) (bool, error) {
+	o, ok := other.(*PNCounter)
+	if !ok {
+		return false, mismatchError(c, other)
+	}
+	p, err := c.p.Merge(o.p)
+	if err != nil {
+		return false, err
+	}
+	n, err := c.n.Merge(o.n)
+	if err != nil {
+		return false, err
+	}
+	return p || n, nil
+}
+
+// Value returns the current value of the counter.
+func (c *PNCounter) Value() any {
+	return c.Sum()
+}
+
+// Equal reports whether other has the same increments and decrements.
+func (c *PNCounter) Equal(other StateCRDT) bool {
+	o, ok := other.(*PNCounter)
+	return ok && c.p.Equal(o.p) && c.n.Equal(o.n)
+}
+
+// pnCounterJSON is the wire format of a PNCounter.
+type pnCounterJSON struct {
+	P *GCounter `json:"p"`
+	N *GCounter `json:"n"`
+}
+
+// MarshalJSON encodes the counter as an object holding both G-Counters.
+func (c *PNCounter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pnCounterJSON{P: c.p, N: c.n})
+}
+
+// UnmarshalJSON decodes an object holding both G-Counters into the counter.
+func (c *PNCounter) UnmarshalJSON(data []byte) error {
+	v := pnCounterJSON{P: NewGCounter(), N: NewGCounter()}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.P == nil {
+		v.P = NewGCounter()
+	}
+	if v.N == nil {
+		v.N = NewGCounter()
+	}
+	c.p, c.n = v.P, v.N
+	return nil
+}
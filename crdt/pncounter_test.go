@@ -0,0 +1,68 @@
+package crdt
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPNCounter_Add(t *testing.T) {
+	c := NewPNCounter()
+	c.Add("n1", 5)
+	c.Add("n1", -2)
+	c.Add("n2", -4)
+
+	require.Equal(t, -1, c.Sum())
+	require.Equal(t, -1, c.Value())
+
+	// Merging the delta into a stale copy catches it up on that entry only.
+	stale := NewPNCounter()
+	delta, err := c.Add("n2", -1)
+	require.NoError(t, err)
+	merge(t, stale, delta)
+	require.Equal(t, -5, stale.Sum())
+
+	// The magnitude of math.MinInt overflows, so it cannot be a decrement.
+	_, err = c.Add("n1", math.MinInt)
+	require.ErrorIs(t, err, ErrDeltaOutOfRange)
+	require.Equal(t, -2, c.Sum())
+}
+
+func TestPNCounter_Merge(t *testing.T) {
+	a, b := NewPNCounter(), NewPNCounter()
+	a.Add("n1", 3)
+	a.Add("n1", -1)
+	b.Add("n2", -5)
+
+	merge(t, a, b)
+	merge(t, b, a)
+	require.Equal(t, -3, a.Sum())
+	require.True(t, a.Equal(b))
+
+	// A stale copy of a decrement must not undo a newer one.
+	stale := NewPNCounter()
+	stale.Add("n2", -1)
+	merge(t, a, stale)
+	require.Equal(t, -3, a.Sum())
+
+	_, err := a.Merge(NewGCounter())
+	require.Error(t, err)
+}
+
+func TestPNCounter_JSON(t *testing.T) {
+	c := NewPNCounter()
+	c.Add("n1", 3)
+	c.Add("n2", -2)
+
+	data, err := c.MarshalJSON()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"p": {"n1": 3}, "n": {"n2": 2}}`, string(data))
+
+	other := NewPNCounter()
+	require.NoError(t, other.UnmarshalJSON(data))
+	require.True(t, c.Equal(other))
+
+	require.NoError(t, other.UnmarshalJSON([]byte(`{}`)))
+	require.Equal(t, 0, other.Sum())
+}
@@ -0,0 +1,94 @@
+package replica
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Config holds the replication settings of a replica, so that programs can
+// expose them as command-line flags and environment variables.
+type Config struct {
+	// Topology is the name of the topology, as accepted by ParseTopology.
+	Topology string
+
+	// Interval and Jitter set Replica.Interval and Replica.Jitter.
+	Interval time.Duration
+	Jitter   time.Duration
+
+	// Fanout is the number of peers a gossip round sends to. Only used by the
+	// "gossip" topology.
+	Fanout int
+
+	// StateDir sets Replica.StateDir. Changes are not persisted if empty.
+	StateDir string
+}
+
+// DefaultConfig returns the settings a Replica uses unless configured
+// otherwise.
+func DefaultConfig() Config {
+	return Config{
+		Topology: "all-to-all",
+		Interval: defaultInterval,
+		Fanout:   defaultFanout,
+	}
+}
+
+// configFlags maps the name of each flag registered by RegisterFlags to the
+// environment variable it defaults to.
+var configFlags = []struct{ flag, env string }{
+	{"topology", "REPLICATION_TOPOLOGY"},
+	{"interval", "REPLICATION_INTERVAL"},
+	{"jitter", "REPLICATION_JITTER"},
+	{"fanout", "REPLICATION_FANOUT"},
+	{"state-dir", "REPLICATION_STATE_DIR"},
+}
+
+// RegisterFlags registers a flag for every setting on fs. Each flag defaults
+// to the value of its REPLICATION_* environment variable, if set, and to the
+// current value of c otherwise. Returns an error if an environment variable
+// holds an invalid value.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) error {
+	fs.StringVar(&c.Topology, "topology", c.Topology, "replication topology: all-to-all, gossip, ring or tree (env REPLICATION_TOPOLOGY)")
+	fs.DurationVar(&c.Interval, "interval", c.Interval, "time between replication rounds (env REPLICATION_INTERVAL)")
+	fs.DurationVar(&c.Jitter, "jitter", c.Jitter, "maximum random delay added to each replication round (env REPLICATION_JITTER)")
+	fs.IntVar(&c.Fanout, "fanout", c.Fanout, "number of peers per gossip round (env REPLICATION_FANOUT)")
+	fs.StringVar(&c.StateDir, "state-dir", c.StateDir, "directory of the write-ahead logs, or empty to keep state in memory only (env REPLICATION_STATE_DIR)")
+
+	for _, f := range configFlags {
+		if v, ok := os.LookupEnv(f.env); ok {
+			if err := fs.Set(f.flag, v); err != nil {
+				return fmt.Errorf("%s: %w", f.env, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Configure applies c to the replica. Must be called before the node is
+// initialized.
+func (r *Replica[T]) Configure(c Config) error {
+	if c.Interval <= 0 {
+		return fmt.Errorf("replication interval must be positive, got %s", c.Interval)
+	} else if c.Jitter < 0 {
+		return fmt.Errorf("replication jitter must not be negative, got %s", c.Jitter)
+	} else if c.Fanout < 1 {
+		return errors.New("gossip fanout must be at least 1")
+	}
+
+	topology, err := ParseTopology(c.Topology)
+	if err != nil {
+		return err
+	}
+	if g, ok := topology.(*Gossip); ok {
+		g.Fanout = c.Fanout
+	}
+
+	r.Topology = topology
+	r.Interval = c.Interval
+	r.Jitter = c.Jitter
+	r.StateDir = c.StateDir
+	return nil
+}
@@ -0,0 +1,53 @@
+package replica
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_RegisterFlags(t *testing.T) {
+	t.Setenv("REPLICATION_INTERVAL", "500ms")
+	t.Setenv("REPLICATION_TOPOLOGY", "gossip")
+
+	c := DefaultConfig()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	require.NoError(t, c.RegisterFlags(fs))
+	require.NoError(t, fs.Parse([]string{"-interval", "2s", "-fanout", "5"}))
+
+	// Flags take precedence over environment variables, which take
+	// precedence over the defaults.
+	require.Equal(t, Config{
+		Topology: "gossip",
+		Interval: 2 * time.Second,
+		Fanout:   5,
+	}, c)
+}
+
+func TestConfig_RegisterFlags_InvalidEnv(t *testing.T) {
+	t.Setenv("REPLICATION_JITTER", "soon")
+
+	c := DefaultConfig()
+	err := c.RegisterFlags(flag.NewFlagSet("test", flag.ContinueOnError))
+	require.ErrorContains(t, err, "REPLICATION_JITTER")
+}
+
+func TestReplica_Configure(t *testing.T) {
+	r := newReplica(t)
+	c := DefaultConfig()
+	c.Topology = "gossip"
+	c.Fanout = 2
+	c.Jitter = time.Second
+	require.NoError(t, r.Configure(c))
+	require.Equal(t, &Gossip{Fanout: 2}, r.Topology)
+	require.Equal(t, defaultInterval, r.Interval)
+	require.Equal(t, time.Second, r.Jitter)
+
+	c.Interval = 0
+	require.Error(t, r.Configure(c))
+	c = DefaultConfig()
+	c.Topology = "star"
+	require.Error(t, r.Configure(c))
+}
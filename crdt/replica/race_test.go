@@ -0,0 +1,171 @@
+package replica
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+	"github.com/project3/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+// cluster returns initialized nodes with the given IDs whose message loops
+// run until the test ends, connected by an in-memory network.
+func cluster(t *testing.T, ids ...string) []*maelstrom.Node {
+	t.Helper()
+
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+
+	nodes := make([]*maelstrom.Node, len(ids))
+	inboxes := make(map[string]chan []byte, len(ids))
+	for i, id := range ids {
+		stdinR, stdinW := io.Pipe()
+		nodes[i] = maelstrom.NewNode()
+		nodes[i].Init(id, ids)
+		nodes[i].Stdin = stdinR
+
+		// Deliver through a buffered inbox so that a node blocked writing
+		// to another cannot deadlock the pair.
+		inbox := make(chan []byte, 1<<16)
+		inboxes[id] = inbox
+		go func() {
+			defer stdinW.Close()
+			for {
+				select {
+				case line := <-inbox:
+					stdinW.Write(line)
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	for _, n := range nodes {
+		stdoutR, stdoutW := io.Pipe()
+		n.Stdout = stdoutW
+		go func() {
+			scanner := bufio.NewScanner(stdoutR)
+			for scanner.Scan() {
+				var msg maelstrom.Message
+				if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+					continue
+				}
+				select {
+				case inboxes[msg.Dest] <- append(slices.Clone(scanner.Bytes()), '\n'):
+				case <-done:
+					return
+				}
+			}
+		}()
+		go n.Run()
+	}
+	return nodes
+}
+
+// hammer concurrently updates every replica ops times with update while
+// reading and replicating them, then replicates until every replica holds
+// the same state and returns it.
+func hammer[T crdt.StateCRDT](t *testing.T, replicas []*Replica[T], ops int, update func(r *Replica[T], i int) error) T {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	for _, r := range replicas {
+		r := r
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < ops; i++ {
+				if err := update(r, i); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < ops; i++ {
+				r.Value()
+				r.Read(func(state T) { state.MarshalJSON() })
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < ops/10; i++ {
+				r.replicate()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var state T
+	require.Eventually(t, func() bool {
+		for _, r := range replicas {
+			r.replicate()
+		}
+		state = snapshot(t, replicas[0])
+		for _, r := range replicas[1:] {
+			if !snapshot(t, r).Equal(state) {
+				return false
+			}
+		}
+		return true
+	}, 10*time.Second, 10*time.Millisecond)
+	return state
+}
+
+// snapshot returns a copy of the replica's state.
+func snapshot[T crdt.StateCRDT](t *testing.T, r *Replica[T]) T {
+	t.Helper()
+	c := r.newState()
+	r.Read(func(state T) {
+		_, err := c.Merge(state)
+		require.NoError(t, err)
+	})
+	return c
+}
+
+func TestReplica_Race_GSet(t *testing.T) {
+	var replicas []*Replica[*crdt.GSet]
+	for _, n := range cluster(t, "n1", "n2", "n3") {
+		r := New(n, crdt.NewGSet)
+		r.Topology = Ring{} // exercise forwarding of received changes
+		replicas = append(replicas, r)
+		t.Cleanup(func() { r.Close() })
+	}
+
+	const ops = 200
+	state := hammer(t, replicas, ops, func(r *Replica[*crdt.GSet], i int) error {
+		element := crdt.MustElement(r.node.ID() + "-" + string(rune('a'+i%26)) + string(rune('a'+i/26)))
+		return r.Update(func(s *crdt.GSet) (crdt.StateCRDT, error) {
+			return s.Add(element), nil
+		})
+	})
+	require.Equal(t, 3*ops, state.Len())
+}
+
+func TestReplica_Race_GCounter(t *testing.T) {
+	dir := t.TempDir()
+	var replicas []*Replica[*crdt.GCounter]
+	for _, n := range cluster(t, "n1", "n2", "n3") {
+		r := New(n, crdt.NewGCounter)
+		r.StateDir = dir // exercise the write-ahead log
+		require.NoError(t, r.restore())
+		replicas = append(replicas, r)
+		t.Cleanup(func() { r.Close() })
+	}
+
+	const ops = 200
+	state := hammer(t, replicas, ops, func(r *Replica[*crdt.GCounter], i int) error {
+		return r.Update(func(c *crdt.GCounter) (crdt.StateCRDT, error) {
+			return c.Increment(r.node.ID(), 1)
+		})
+	})
+	require.Equal(t, 3*ops, state.Sum())
+}
@@ -0,0 +1,555 @@
+// Package replica replicates a crdt.StateCRDT across a Maelstrom cluster.
+//
+// A Replica owns the local copy of the CRDT, registers the "init",
+// "replicate" and "topology" handlers on a maelstrom.Node and periodically
+// ships changes to the peers chosen by its Topology. Programs only need to
+// register handlers for their client operations and route them through
+// Update and Value.
+//
+// A Replica is safe for concurrent use. The local state is only accessed with
+// the replica's lock held, including while it is encoded for replication or
+// logged to disk, and client handlers reach it only through Update, Read,
+// Value and Merge.
+//
+// Replication is delta-based: every Update records the delta state produced
+// by the mutation, and each peer is sent the join of the deltas it has not yet
+// acknowledged. A peer that has never acknowledged anything, or whose
+// acknowledged position has fallen out of the delta buffer, is sent the full
+// state instead. Unless the topology is AllToAll, changes received from peers
+// that inflate the local state are buffered as deltas too, so they are
+// forwarded to nodes that the originating node does not send to.
+//
+// Peers acknowledge every "replicate" message with a "replicate_ok". Failed
+// deliveries are retried with exponential backoff, and each round logs how
+// many changes every peer is behind and when it last acknowledged any.
+// Replication stops when the node's message loop returns or Close is called.
+//
+// With StateDir set, every change to the local state is logged to disk and
+// replayed when the node restarts.
+//
+// Programs can replace the full-state fallback with a cheaper reconciliation
+// protocol, such as exchanging digests, by setting FullSync.
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+	"github.com/project3/crdt"
+)
+
+// defaultInterval is how often a replica pushes its changes to its peers
+// unless configured otherwise.
+const defaultInterval = 3 * time.Second
+
+// Delivery of changes to a peer. Each attempt waits up to replicateTimeout
+// for the peer's "replicate_ok", or fullSyncTimeout for a FullSync call.
+// Failed attempts are retried after a backoff that starts at initialBackoff
+// and doubles up to maxBackoff, for at most maxAttempts attempts per round.
+const (
+	replicateTimeout = time.Second
+	fullSyncTimeout  = 5 * time.Second
+	initialBackoff   = 100 * time.Millisecond
+	maxBackoff       = time.Second
+	maxAttempts      = 4
+)
+
+// maxDeltas is the number of deltas buffered before the oldest are dropped.
+// Peers that have not acknowledged the dropped deltas receive the full state.
+const maxDeltas = 1024
+
+// Replica is the local copy of a CRDT of type T replicated over a node.
+type Replica[T crdt.StateCRDT] struct {
+	mu       sync.Mutex
+	state    T
+	newState func() T
+
+	// deltas holds the deltas with sequence numbers (seq-len(deltas), seq].
+	deltas []crdt.StateCRDT
+	seq    int
+
+	// acked holds the highest sequence number acknowledged by each peer that
+	// has been replicated to, or -1 if it has not acknowledged anything yet.
+	acked map[string]int
+
+	// lastAck holds the time each peer last acknowledged a change.
+	lastAck map[string]time.Time
+
+	// inflight holds the peers with a delivery in flight.
+	inflight map[string]bool
+
+	node *maelstrom.Node
+
+	// ctx is cancelled by Close, or when the node stops, to stop
+	// replication. wg tracks the deliveries in flight, and stopPeriodic stops
+	// the replication rounds.
+	ctx          context.Context
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+	stopPeriodic func()
+
+	// Topology selects the peers to replicate to on each round.
+	// Defaults to AllToAll. Must be set before the node is initialized.
+	Topology Topology
+
+	// Interval is the time between replication rounds. Each round is delayed
+	// by a random duration of up to Jitter so that nodes do not replicate in
+	// lockstep. Defaults to defaultInterval and no jitter. Must be set before
+	// the node is initialized.
+	Interval time.Duration
+	Jitter   time.Duration
+
+	// StateDir, if set, is the directory holding the write-ahead log of every
+	// node, named after its node ID. The log is replayed when the node is
+	// initialized and every change is synced to it before it is replicated
+	// or Update or Merge returns, so a restarted node resumes with at least
+	// the changes it made or shipped before. Must be set before the node is
+	// initialized.
+	StateDir string
+	wal      *wal
+
+	// FullSync, if set, is called instead of sending the full state to a peer
+	// that cannot catch up from the delta buffer. It must leave the peer with
+	// at least the local state as of the call. Must be set before the node is
+	// initialized.
+	FullSync func(ctx context.Context, peer string) error
+}
+
+// New returns a replica of an empty CRDT created by newState and registers
+// its handlers on node. newState is also used to decode the states received
+// from peers.
+func New[T crdt.StateCRDT](node *maelstrom.Node, newState func() T) *Replica[T] {
+	ctx, cancel := context.WithCancel(node.Context())
+	r := &Replica[T]{
+		state:    newState(),
+		newState: newState,
+		acked:    make(map[string]int),
+		lastAck:  make(map[string]time.Time),
+		inflight: make(map[string]bool),
+		node:     node,
+		ctx:      ctx,
+		cancel:   cancel,
+		Topology: AllToAll{},
+		Interval: defaultInterval,
+	}
+	node.Handle("init", r.handleInit)
+	maelstrom.HandleTyped(node, "replicate", r.handleReplicate)
+	maelstrom.HandleTyped(node, "topology", r.handleTopology)
+	return r
+}
+
+// Update calls fn with exclusive access to the local state. fn returns the
+// delta state produced by its mutation, which is queued for replication and
+// must not be modified afterwards. Returning a nil delta causes the full state
+// to be sent to every peer on the next round instead.
+//
+// With a write-ahead log, the change is only queued once it is logged. If it
+// cannot be logged, the local state is rolled back and an error is returned.
+func (r *Replica[T]) Update(fn func(state T) (crdt.StateCRDT, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delta, err := fn(r.state)
+	if err != nil {
+		return err
+	}
+
+	var change crdt.StateCRDT = r.state
+	if delta != nil {
+		change = delta
+	}
+	if err := r.persist(change); err != nil {
+		return err
+	}
+	r.record(delta)
+	return r.compactLog()
+}
+
+// record appends delta to the delta buffer. A nil delta empties the buffer so
+// that every peer is sent the full state. Must be called with the lock held.
+func (r *Replica[T]) record(delta crdt.StateCRDT) {
+	r.seq++
+	if delta == nil {
+		r.deltas = nil // no peer can catch up from the buffer anymore
+		return
+	}
+	r.deltas = append(r.deltas, delta)
+	if len(r.deltas) > maxDeltas {
+		r.deltas = r.deltas[len(r.deltas)-maxDeltas:]
+	}
+}
+
+// Read calls fn with exclusive access to the local state. fn must not modify
+// the state or keep references into it after returning.
+func (r *Replica[T]) Read(fn func(state T)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(r.state)
+}
+
+// Value returns the user-visible value of the local state.
+func (r *Replica[T]) Value() any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state.Value()
+}
+
+// replicateMessageBody represents the body for the "replicate" message.
+type replicateMessageBody struct {
+	maelstrom.MessageBody
+	Value json.RawMessage `json:"value"`
+}
+
+// topologyMessageBody represents the body for the "topology" message.
+type topologyMessageBody struct {
+	maelstrom.MessageBody
+	Topology map[string][]string `json:"topology"`
+}
+
+func (r *Replica[T]) handleInit(msg maelstrom.Message) error {
+	if r.StateDir != "" {
+		if err := r.restore(); err != nil {
+			return err
+		}
+	}
+	r.periodic()
+	return nil
+}
+
+func (r *Replica[T]) handleReplicate(msg maelstrom.Message, body replicateMessageBody) (maelstrom.MessageBody, error) {
+	other := r.newState()
+	if err := other.UnmarshalJSON(body.Value); err != nil {
+		return maelstrom.MessageBody{}, maelstrom.NewRPCError(maelstrom.MalformedRequest, err.Error())
+	}
+
+	if err := r.Merge(other); err != nil {
+		return maelstrom.MessageBody{}, err
+	}
+	return maelstrom.MessageBody{Type: "replicate_ok"}, nil
+}
+
+// Merge joins a state received from a peer into the local state. If other
+// carried changes that the local state did not have, it is recorded as a
+// delta to be forwarded, so other must not be modified afterwards.
+func (r *Replica[T]) Merge(other T) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed, err := r.state.Merge(other)
+	if err != nil || !changed {
+		return err
+	}
+	if err := r.persist(other); err != nil {
+		return err
+	}
+
+	// Every peer hears from the originating node directly, so received
+	// changes are only forwarded by other topologies.
+	if _, allToAll := r.Topology.(AllToAll); !allToAll {
+		r.record(other)
+	}
+	return r.compactLog()
+}
+
+// restore replays the node's write-ahead log in StateDir into the local state
+// and keeps logging changes to it.
+func (r *Replica[T]) restore() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path := filepath.Join(r.StateDir, r.node.ID()+".wal")
+	w, err := openWAL(path, r.mergeInto(r.state), func() crdt.StateCRDT { return r.state })
+	if err != nil {
+		return err
+	}
+	r.wal = w
+	return nil
+}
+
+// mergeInto returns a function that merges a record of the write-ahead log
+// into state.
+func (r *Replica[T]) mergeInto(state T) func(record []byte) error {
+	return func(record []byte) error {
+		other := r.newState()
+		if err := other.UnmarshalJSON(record); err != nil {
+			return err
+		}
+		_, err := state.Merge(other)
+		return err
+	}
+}
+
+// persist appends a change that has been applied to the local state to the
+// write-ahead log, if there is one. If the change cannot be logged, the local
+// state is rolled back to the one in the log, so that no change is replicated
+// before it is durable. Must be called with the lock held.
+func (r *Replica[T]) persist(change crdt.StateCRDT) error {
+	if r.wal == nil {
+		return nil
+	}
+	if err := r.wal.append(change); err != nil {
+		if rerr := r.rollback(); rerr != nil {
+			return errors.Join(err, fmt.Errorf("roll back: %w", rerr))
+		}
+		return err
+	}
+	return nil
+}
+
+// rollback replaces the local state with the one in the write-ahead log.
+// Must be called with the lock held.
+func (r *Replica[T]) rollback() error {
+	state := r.newState()
+	if err := replay(r.wal.path, r.mergeInto(state)); err != nil {
+		return err
+	}
+	r.state = state
+	return nil
+}
+
+// compactLog compacts the write-ahead log, if there is one, once it grows
+// past maxLogRecords. Must be called with the lock held.
+func (r *Replica[T]) compactLog() error {
+	if r.wal == nil || r.wal.records < maxLogRecords {
+		return nil
+	}
+	return r.wal.compact(r.state)
+}
+
+// handleTopology builds the spanning tree from the neighbors Maelstrom
+// assigns, if the replica uses a Tree topology.
+func (r *Replica[T]) handleTopology(msg maelstrom.Message, body topologyMessageBody) (maelstrom.MessageBody, error) {
+	if t, ok := r.Topology.(*Tree); ok {
+		t.SetGraph(body.Topology)
+	}
+	return maelstrom.MessageBody{Type: "topology_ok"}, nil
+}
+
+// payload returns the state to send to peer and the sequence number it
+// covers. full is true if payload is the full state. Returns a nil payload if
+// peer is already up to date. Must be called with the lock held.
+func (r *Replica[T]) payload(peer string) (payload crdt.StateCRDT, seq int, full bool, err error) {
+	acked, ok := r.acked[peer]
+	if !ok {
+		acked = -1
+		r.acked[peer] = acked
+	} else if acked == r.seq {
+		return nil, r.seq, false, nil
+	}
+
+	// Send the full state if the peer is new or lagging behind the buffer.
+	base := r.seq - len(r.deltas)
+	if acked < base {
+		return r.state, r.seq, true, nil
+	}
+
+	delta := r.newState()
+	for _, d := range r.deltas[acked-base:] {
+		if _, err := delta.Merge(d); err != nil {
+			return nil, 0, false, err
+		}
+	}
+	return delta, r.seq, false, nil
+}
+
+// ack records that peer has merged every change up to seq and drops the
+// deltas that every peer replicated to so far has acknowledged.
+func (r *Replica[T]) ack(peer string, seq int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.acked[peer] < seq {
+		r.acked[peer] = seq
+	}
+	r.lastAck[peer] = time.Now()
+
+	low := r.seq
+	for _, acked := range r.acked {
+		if acked < low {
+			low = acked
+		}
+	}
+	if base := r.seq - len(r.deltas); low > base {
+		r.deltas = r.deltas[low-base:]
+	}
+}
+
+// replicate sends the peers chosen by the topology the changes they have not
+// acknowledged yet and logs how far behind each peer is.
+func (r *Replica[T]) replicate() {
+	for _, dest := range r.Topology.Peers(r.node.ID(), r.node.NodeIDs()) {
+		r.replicateTo(dest)
+	}
+	r.logLag(time.Now())
+}
+
+// replicateTo starts delivering dest the changes it has not acknowledged yet,
+// unless a delivery to dest is already in flight.
+func (r *Replica[T]) replicateTo(dest string) {
+	r.mu.Lock()
+	inflight := r.inflight[dest]
+	r.inflight[dest] = true
+	r.mu.Unlock()
+	if inflight {
+		return
+	}
+
+	r.wg.Add(1)
+	r.node.Go(func(context.Context) {
+		defer r.wg.Done()
+		defer func() {
+			r.mu.Lock()
+			delete(r.inflight, dest)
+			r.mu.Unlock()
+		}()
+		if err := r.deliver(dest); err != nil {
+			log.Printf("replicate to %s: %s", dest, err)
+		}
+	})
+}
+
+// deliver sends dest the changes it has not acknowledged yet and waits for the
+// acknowledgement. Failed attempts are retried with exponential backoff up to
+// maxAttempts times. Each attempt sends whatever dest is missing at that time.
+func (r *Replica[T]) deliver(dest string) error {
+	return deliverPolicy.Do(r.ctx, func(ctx context.Context) error {
+		return r.send(ctx, dest)
+	})
+}
+
+// deliverPolicy retries the attempts of deliver. Attempts bound themselves,
+// as full syncs take longer than deltas.
+var deliverPolicy = maelstrom.RetryPolicy{
+	MaxAttempts: maxAttempts,
+	Backoff:     initialBackoff,
+	MaxBackoff:  maxBackoff,
+	Retryable:   retryable,
+}
+
+// send makes a single attempt at bringing dest up to date.
+func (r *Replica[T]) send(ctx context.Context, dest string) error {
+	r.mu.Lock()
+	payload, seq, full, err := r.payload(dest)
+	if err != nil || payload == nil {
+		r.mu.Unlock()
+		return err
+	}
+
+	if full && r.FullSync != nil {
+		r.mu.Unlock()
+		ctx, cancel := context.WithTimeout(ctx, fullSyncTimeout)
+		defer cancel()
+		if err := r.FullSync(ctx, dest); err != nil {
+			return fmt.Errorf("full sync: %w", err)
+		}
+		r.ack(dest, seq)
+		return nil
+	}
+
+	value, err := payload.MarshalJSON()
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// SyncRPC forgets the request when the context is done, so a late
+	// replicate_ok is ignored.
+	ctx, cancel := context.WithTimeout(ctx, replicateTimeout)
+	defer cancel()
+	if _, err := r.node.SyncRPC(ctx, dest, replicateMessageBody{
+		MessageBody: maelstrom.MessageBody{Type: "replicate"},
+		Value:       value,
+	}); err != nil {
+		return err
+	}
+	r.ack(dest, seq)
+	return nil
+}
+
+// retryable reports whether a failed replication attempt may succeed if
+// retried. Timeouts and transient node failures are retried; requests the
+// peer rejected as malformed or unsupported are not.
+func retryable(err error) bool {
+	switch maelstrom.ErrorCode(err) {
+	case maelstrom.MalformedRequest, maelstrom.NotSupported:
+		return false
+	default:
+		return true
+	}
+}
+
+// logLag logs the number of changes each peer replicated to has not
+// acknowledged and how long ago it last acknowledged any.
+func (r *Replica[T]) logLag(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	peers := make([]string, 0, len(r.acked))
+	for peer := range r.acked {
+		peers = append(peers, peer)
+	}
+	slices.Sort(peers)
+
+	for _, peer := range peers {
+		lag := r.seq - r.acked[peer]
+		if r.acked[peer] == -1 {
+			lag = r.seq
+		}
+		last, ok := r.lastAck[peer]
+		if !ok {
+			log.Printf("replication lag to %s: %d changes, never acknowledged", peer, lag)
+			continue
+		}
+		log.Printf("replication lag to %s: %d changes, last ack %s ago", peer, lag, now.Sub(last).Round(time.Millisecond))
+	}
+}
+
+// periodic replicates changes every Interval plus jitter until Close is
+// called or the node stops.
+func (r *Replica[T]) periodic() {
+	stop := r.node.Every(r.Interval, func(ctx context.Context) {
+		if r.Jitter > 0 {
+			select {
+			case <-time.After(time.Duration(rand.Int63n(int64(r.Jitter)))):
+			case <-ctx.Done():
+				return
+			}
+		}
+		r.replicate()
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopPeriodic = stop
+}
+
+// Close stops replication, waits for the deliveries in flight to give up and
+// closes the write-ahead log. Programs call it once the node's message loop
+// has returned, by which time replication has already stopped.
+func (r *Replica[T]) Close() error {
+	r.cancel()
+
+	r.mu.Lock()
+	stop := r.stopPeriodic
+	r.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+	r.wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.wal == nil {
+		return nil
+	}
+	return r.wal.Close()
+}
@@ -0,0 +1,233 @@
+package replica
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+	"github.com/project3/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+// newReplica returns a G-Set replica for n1 in a three node cluster.
+func newReplica(t *testing.T) *Replica[*crdt.GSet] {
+	t.Helper()
+	n := maelstrom.NewNode()
+	n.Init("n1", []string{"n1", "n2", "n3"})
+	return New(n, crdt.NewGSet)
+}
+
+// add adds element to the replica's set.
+func add(t *testing.T, r *Replica[*crdt.GSet], element int) {
+	t.Helper()
+	require.NoError(t, r.Update(func(s *crdt.GSet) (crdt.StateCRDT, error) {
+		return s.Add(crdt.MustElement(element)), nil
+	}))
+}
+
+// elements returns the elements of the payload for peer.
+func elements(t *testing.T, r *Replica[*crdt.GSet], peer string) ([]crdt.Element, int) {
+	t.Helper()
+	payload, seq, _, err := r.payload(peer)
+	require.NoError(t, err)
+	if payload == nil {
+		return nil, seq
+	}
+	return payload.(*crdt.GSet).Elements(), seq
+}
+
+// ints returns the elements encoding each of values.
+func ints(values ...int) []crdt.Element {
+	elements := make([]crdt.Element, len(values))
+	for i, v := range values {
+		elements[i] = crdt.MustElement(v)
+	}
+	return elements
+}
+
+func TestReplica_Payload(t *testing.T) {
+	r := newReplica(t)
+	add(t, r, 1)
+	add(t, r, 2)
+
+	// A peer that never acknowledged anything receives the full state.
+	got, seq := elements(t, r, "n2")
+	require.ElementsMatch(t, ints(1, 2), got)
+	require.Equal(t, 2, seq)
+	got, _ = elements(t, r, "n3")
+	require.ElementsMatch(t, ints(1, 2), got)
+	r.ack("n2", seq)
+
+	// Once acknowledged, only new deltas are sent.
+	got, _ = elements(t, r, "n2")
+	require.Nil(t, got)
+	add(t, r, 3)
+	got, seq = elements(t, r, "n2")
+	require.Equal(t, ints(3), got)
+	require.Equal(t, 3, seq)
+
+	// Deltas are kept until every peer has acknowledged them.
+	require.Len(t, r.deltas, 3)
+	r.ack("n3", 2)
+	require.Len(t, r.deltas, 1)
+	r.ack("n2", 3)
+	r.ack("n3", 3)
+	require.Len(t, r.deltas, 0)
+}
+
+func TestReplica_Payload_Lagging(t *testing.T) {
+	r := newReplica(t)
+	add(t, r, 1)
+	r.ack("n2", 1)
+	r.ack("n3", 1)
+
+	// Overflowing the buffer drops deltas n2 never acknowledged.
+	for i := 0; i < maxDeltas+1; i++ {
+		add(t, r, i+2)
+	}
+	got, _ := elements(t, r, "n2")
+	require.Len(t, got, maxDeltas+2, "lagging peer should receive the full state")
+}
+
+func TestReplica_Update_NilDelta(t *testing.T) {
+	r := newReplica(t)
+	add(t, r, 1)
+	r.ack("n2", 1)
+
+	require.NoError(t, r.Update(func(s *crdt.GSet) (crdt.StateCRDT, error) {
+		s.Add(crdt.MustElement(2))
+		return nil, nil
+	}))
+	got, _ := elements(t, r, "n2")
+	require.ElementsMatch(t, ints(1, 2), got, "nil delta should force a full state")
+}
+
+func TestReplica_Merge_Forward(t *testing.T) {
+	r := newReplica(t)
+	r.Topology = Ring{}
+
+	other := crdt.NewGSet()
+	other.Add(crdt.MustElement(1))
+	require.NoError(t, r.Merge(other))
+	require.Len(t, r.deltas, 1, "new changes should be buffered for forwarding")
+
+	require.NoError(t, r.Merge(other))
+	require.Len(t, r.deltas, 1, "known changes should not be forwarded again")
+
+	// Received changes are not forwarded when every node sends to every other.
+	r = newReplica(t)
+	require.NoError(t, r.Merge(other))
+	require.Len(t, r.deltas, 0)
+}
+
+// peer runs n's message loop with n2 answering every message n sends with the
+// error code returned by code, or "replicate_ok" if it returns zero. Returns
+// the number of messages n2 received so far.
+func peer(t *testing.T, n *maelstrom.Node, code func(attempt int) int) func() int {
+	t.Helper()
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	n.Stdin, n.Stdout = stdinR, stdoutW
+	t.Cleanup(func() { stdinW.Close(); stdoutR.Close() })
+
+	go n.Run()
+
+	received := make(chan int, 1)
+	received <- 0
+	go func() {
+		scanner := bufio.NewScanner(stdoutR)
+		for scanner.Scan() {
+			var msg maelstrom.Message
+			var body maelstrom.MessageBody
+			if json.Unmarshal(scanner.Bytes(), &msg) != nil || json.Unmarshal(msg.Body, &body) != nil {
+				continue
+			}
+			attempt := <-received + 1
+			received <- attempt
+
+			reply := fmt.Sprintf(`{"type":"replicate_ok","in_reply_to":%d}`, body.MsgID)
+			if c := code(attempt); c != 0 {
+				reply = fmt.Sprintf(`{"type":"error","code":%d,"in_reply_to":%d}`, c, body.MsgID)
+			}
+			fmt.Fprintf(stdinW, `{"src":"n2","dest":"n1","body":%s}`+"\n", reply)
+		}
+	}()
+
+	return func() int {
+		attempt := <-received
+		received <- attempt
+		return attempt
+	}
+}
+
+func TestReplica_Deliver_Retry(t *testing.T) {
+	r := newReplica(t)
+	attempts := peer(t, r.node, func(attempt int) int {
+		if attempt == 1 {
+			return maelstrom.TemporarilyUnavailable
+		}
+		return 0
+	})
+	add(t, r, 1)
+
+	require.NoError(t, r.deliver("n2"))
+	require.Equal(t, 2, attempts())
+	require.Equal(t, 1, r.acked["n2"])
+	require.Contains(t, r.lastAck, "n2")
+}
+
+func TestReplica_Deliver_NotRetryable(t *testing.T) {
+	r := newReplica(t)
+	attempts := peer(t, r.node, func(int) int { return maelstrom.MalformedRequest })
+	add(t, r, 1)
+
+	require.Error(t, r.deliver("n2"))
+	require.Equal(t, 1, attempts(), "malformed requests should not be retried")
+	require.Equal(t, -1, r.acked["n2"])
+	require.NotContains(t, r.lastAck, "n2")
+}
+
+func TestReplica_Close(t *testing.T) {
+	r := newReplica(t)
+	r.node.Stdout = io.Discard // peers never acknowledge
+	r.Interval = time.Millisecond
+	r.periodic()
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		r.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not stop the replication loop")
+	}
+}
+
+// Ensure replication stops with the node's message loop, without Close.
+func TestReplica_NodeStop(t *testing.T) {
+	r := newReplica(t)
+	stdinR, stdinW := io.Pipe()
+	r.node.Stdin, r.node.Stdout = stdinR, io.Discard // peers never acknowledge
+	r.Interval = time.Millisecond
+	r.periodic()
+
+	done := make(chan error, 1)
+	go func() { done <- r.node.Run() }()
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, stdinW.Close())
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("node did not stop the replication loop")
+	}
+	require.NoError(t, r.Close())
+}
@@ -0,0 +1,179 @@
+package replica
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+)
+
+// defaultFanout is the number of peers a gossip round sends to.
+const defaultFanout = 3
+
+// Topology selects the peers a replica sends its changes to on each round.
+// Topologies other than AllToAll rely on replicas forwarding the changes they
+// receive, so a change may take several rounds to reach every node.
+type Topology interface {
+	// Peers returns the peers self replicates to this round. nodeIDs is every
+	// node in the cluster, including self.
+	Peers(self string, nodeIDs []string) []string
+}
+
+// ParseTopology returns the topology with the given name: "all-to-all",
+// "gossip", "ring" or "tree".
+func ParseTopology(name string) (Topology, error) {
+	switch name {
+	case "all-to-all":
+		return AllToAll{}, nil
+	case "gossip":
+		return &Gossip{Fanout: defaultFanout}, nil
+	case "ring":
+		return Ring{}, nil
+	case "tree":
+		return &Tree{}, nil
+	default:
+		return nil, fmt.Errorf("unknown topology %q", name)
+	}
+}
+
+// AllToAll replicates to every other node on every round. Changes converge in
+// a single round at the cost of O(n²) messages per round.
+type AllToAll struct{}
+
+// Peers returns every node except self.
+func (AllToAll) Peers(self string, nodeIDs []string) []string {
+	return others(self, nodeIDs)
+}
+
+// Gossip replicates to Fanout peers chosen at random on every round.
+type Gossip struct {
+	Fanout int
+
+	// Rand is the source of randomness. Uses the global source if nil.
+	Rand *rand.Rand
+}
+
+// Peers returns up to Fanout random nodes other than self.
+func (g *Gossip) Peers(self string, nodeIDs []string) []string {
+	peers := others(self, nodeIDs)
+	shuffle := rand.Shuffle
+	if g.Rand != nil {
+		shuffle = g.Rand.Shuffle
+	}
+	shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	if len(peers) > g.Fanout {
+		peers = peers[:g.Fanout]
+	}
+	return peers
+}
+
+// Ring replicates to the next node in sorted node ID order, so every node
+// sends exactly one message per round.
+type Ring struct{}
+
+// Peers returns the successor of self on the ring.
+func (Ring) Peers(self string, nodeIDs []string) []string {
+	sorted := slices.Clone(nodeIDs)
+	slices.Sort(sorted)
+	i := slices.Index(sorted, self)
+	if i == -1 || len(sorted) < 2 {
+		return nil
+	}
+	return []string{sorted[(i+1)%len(sorted)]}
+}
+
+// Tree replicates along the edges of a spanning tree. The tree is built by a
+// breadth-first search from the lowest node ID over the graph received in a
+// Maelstrom "topology" message. Until one is received, nodes are arranged in
+// a binary tree in sorted node ID order.
+type Tree struct {
+	mu    sync.Mutex
+	graph map[string][]string
+}
+
+// SetGraph sets the neighbor graph that the spanning tree is built from.
+func (t *Tree) SetGraph(graph map[string][]string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.graph = graph
+}
+
+// Peers returns the parent and children of self in the spanning tree.
+func (t *Tree) Peers(self string, nodeIDs []string) []string {
+	t.mu.Lock()
+	graph := t.graph
+	t.mu.Unlock()
+
+	sorted := slices.Clone(nodeIDs)
+	slices.Sort(sorted)
+	if graph == nil {
+		return binaryTreePeers(self, sorted)
+	}
+	return spanningTreePeers(self, sorted, graph)
+}
+
+// binaryTreePeers returns the neighbors of self in a binary tree laid out
+// over sorted in heap order.
+func binaryTreePeers(self string, sorted []string) []string {
+	i := slices.Index(sorted, self)
+	if i == -1 {
+		return nil
+	}
+
+	var peers []string
+	if i > 0 {
+		peers = append(peers, sorted[(i-1)/2])
+	}
+	for _, child := range []int{2*i + 1, 2*i + 2} {
+		if child < len(sorted) {
+			peers = append(peers, sorted[child])
+		}
+	}
+	return peers
+}
+
+// spanningTreePeers returns the neighbors of self in the breadth-first
+// spanning tree of graph rooted at the lowest node ID.
+func spanningTreePeers(self string, sorted []string, graph map[string][]string) []string {
+	if len(sorted) == 0 {
+		return nil
+	}
+
+	parent := map[string]string{sorted[0]: ""}
+	queue := []string{sorted[0]}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		neighbors := slices.Clone(graph[id])
+		slices.Sort(neighbors)
+		for _, neighbor := range neighbors {
+			if _, ok := parent[neighbor]; !ok {
+				parent[neighbor] = id
+				queue = append(queue, neighbor)
+			}
+		}
+	}
+
+	var peers []string
+	if p := parent[self]; p != "" {
+		peers = append(peers, p)
+	}
+	for _, id := range sorted {
+		if parent[id] == self {
+			peers = append(peers, id)
+		}
+	}
+	return peers
+}
+
+// others returns every node in nodeIDs except self.
+func others(self string, nodeIDs []string) []string {
+	peers := make([]string, 0, len(nodeIDs))
+	for _, id := range nodeIDs {
+		if id != self {
+			peers = append(peers, id)
+		}
+	}
+	return peers
+}
@@ -0,0 +1,65 @@
+package replica
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var nodeIDs = []string{"n3", "n1", "n4", "n0", "n2"}
+
+func TestParseTopology(t *testing.T) {
+	for _, name := range []string{"all-to-all", "gossip", "ring", "tree"} {
+		_, err := ParseTopology(name)
+		require.NoError(t, err, name)
+	}
+	_, err := ParseTopology("mesh")
+	require.EqualError(t, err, `unknown topology "mesh"`)
+}
+
+func TestAllToAll_Peers(t *testing.T) {
+	require.Equal(t, []string{"n3", "n4", "n0", "n2"}, AllToAll{}.Peers("n1", nodeIDs))
+}
+
+func TestGossip_Peers(t *testing.T) {
+	g := &Gossip{Fanout: 2, Rand: rand.New(rand.NewSource(1))}
+	for i := 0; i < 10; i++ {
+		peers := g.Peers("n1", nodeIDs)
+		require.Len(t, peers, 2)
+		require.NotContains(t, peers, "n1")
+	}
+
+	g.Fanout = 10
+	require.Len(t, g.Peers("n1", nodeIDs), 4)
+}
+
+func TestRing_Peers(t *testing.T) {
+	require.Equal(t, []string{"n2"}, Ring{}.Peers("n1", nodeIDs))
+	require.Equal(t, []string{"n0"}, Ring{}.Peers("n4", nodeIDs))
+	require.Nil(t, Ring{}.Peers("n1", []string{"n1"}))
+}
+
+func TestTree_Peers(t *testing.T) {
+	t.Run("BinaryTree", func(t *testing.T) {
+		tree := &Tree{}
+		require.Equal(t, []string{"n1", "n2"}, tree.Peers("n0", nodeIDs))
+		require.Equal(t, []string{"n0", "n3", "n4"}, tree.Peers("n1", nodeIDs))
+		require.Equal(t, []string{"n1"}, tree.Peers("n4", nodeIDs))
+	})
+
+	t.Run("SpanningTree", func(t *testing.T) {
+		// A cycle n0-n1-n2-n3-n4-n0 where the edge n2-n3 is not part of the tree.
+		tree := &Tree{}
+		tree.SetGraph(map[string][]string{
+			"n0": {"n1", "n4"},
+			"n1": {"n0", "n2"},
+			"n2": {"n1", "n3"},
+			"n3": {"n2", "n4"},
+			"n4": {"n3", "n0"},
+		})
+		require.Equal(t, []string{"n1", "n4"}, tree.Peers("n0", nodeIDs))
+		require.Equal(t, []string{"n1"}, tree.Peers("n2", nodeIDs))
+		require.Equal(t, []string{"n4"}, tree.Peers("n3", nodeIDs))
+	})
+}
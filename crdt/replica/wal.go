@@ -0,0 +1,157 @@
+package replica
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/project3/crdt"
+)
+
+// maxLogRecords is the number of records appended to a write-ahead log
+// before it is compacted into a snapshot of the full state.
+const maxLogRecords = 1024
+
+// wal is a write-ahead log of the states merged into a replica, stored as one
+// JSON document per line. Replaying the log merges every record in order, so
+// the first record of a compacted log is a snapshot of the full state and the
+// rest are deltas. Records are synced to disk before append returns.
+type wal struct {
+	path    string
+	f       *os.File
+	records int
+}
+
+// openWAL replays the log at path by calling apply with every record, then
+// compacts it into snapshot, which must return the state after replay. A
+// missing log is treated as empty. A torn last record, left by a crash in the
+// middle of an append, is discarded.
+func openWAL(path string, apply func(record []byte) error, snapshot func() crdt.StateCRDT) (*wal, error) {
+	if err := replay(path, apply); err != nil {
+		return nil, fmt.Errorf("replay %s: %w", path, err)
+	}
+
+	w := &wal{path: path}
+	if err := w.compact(snapshot()); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// replay calls apply with every record of the log at path.
+func replay(path string, apply func(record []byte) error) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return nil // a record without a newline is torn
+		} else if err != nil {
+			return err
+		}
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+		if err := apply(line); err != nil {
+			return err
+		}
+	}
+}
+
+// append writes s to the log and syncs it to disk. If either fails, the
+// record is truncated away, so that it is neither replayed nor extended by
+// the next one.
+func (w *wal) append(s crdt.StateCRDT) error {
+	buf, err := s.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	off, err := w.f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.f.Write(append(buf, '\n'))
+	if err == nil {
+		err = w.f.Sync()
+	}
+	if err != nil {
+		if terr := w.f.Truncate(off); terr != nil {
+			return errors.Join(err, fmt.Errorf("truncate: %w", terr))
+		}
+		return err
+	}
+	w.records++
+	return nil
+}
+
+// compact atomically replaces the log with a snapshot of state.
+func (w *wal) compact(state crdt.StateCRDT) error {
+	buf, err := state.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	tmp := w.path + ".tmp"
+	if err := writeFileSync(tmp, append(buf, '\n')); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, w.path); err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(w.path)); err != nil {
+		return err
+	}
+
+	if w.f != nil {
+		w.f.Close()
+	}
+	if w.f, err = os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND, 0); err != nil {
+		return err
+	}
+	w.records = 1
+	return nil
+}
+
+// Close closes the log file.
+func (w *wal) Close() error {
+	return w.f.Close()
+}
+
+// writeFileSync writes data to the file at path and syncs it to disk.
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir syncs the directory at path, so that a rename within it is durable.
+func syncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
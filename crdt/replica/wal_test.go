@@ -0,0 +1,118 @@
+package replica
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+	"github.com/project3/crdt"
+	"github.com/stretchr/testify/require"
+)
+
+// restart returns a G-Counter replica for n1 restored from the logs in dir.
+func restart(t *testing.T, dir string) *Replica[*crdt.GCounter] {
+	t.Helper()
+	n := maelstrom.NewNode()
+	n.Init("n1", []string{"n1", "n2"})
+	r := New(n, crdt.NewGCounter)
+	r.StateDir = dir
+	require.NoError(t, r.restore())
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// increment adds delta to n1's entry of the replica's counter.
+func increment(t *testing.T, r *Replica[*crdt.GCounter], delta int) {
+	t.Helper()
+	require.NoError(t, r.Update(func(c *crdt.GCounter) (crdt.StateCRDT, error) {
+		return c.Increment("n1", delta)
+	}))
+}
+
+func TestReplica_Restore(t *testing.T) {
+	dir := t.TempDir()
+
+	r := restart(t, dir)
+	increment(t, r, 2)
+	increment(t, r, 3)
+	other := crdt.NewGCounter()
+	other.Increment("n2", 4)
+	require.NoError(t, r.Merge(other))
+	require.NoError(t, r.Close())
+
+	// The restarted node resumes its own contribution rather than counting
+	// from zero, and remembers what it heard from peers.
+	r = restart(t, dir)
+	increment(t, r, 1)
+	r.Read(func(c *crdt.GCounter) {
+		require.Equal(t, 6, c.Count("n1"))
+		require.Equal(t, 4, c.Count("n2"))
+	})
+	require.NoError(t, r.Close())
+
+	r = restart(t, dir)
+	require.Equal(t, 10, r.Value())
+}
+
+func TestReplica_Restore_Compact(t *testing.T) {
+	dir := t.TempDir()
+
+	r := restart(t, dir)
+	for i := 0; i < maxLogRecords+10; i++ {
+		increment(t, r, 1)
+	}
+	require.LessOrEqual(t, r.wal.records, maxLogRecords)
+	require.NoError(t, r.Close())
+
+	r = restart(t, dir)
+	require.Equal(t, maxLogRecords+10, r.Value())
+	require.Equal(t, 1, r.wal.records, "replayed log should be compacted")
+}
+
+// Ensure a change that cannot be logged is rolled back rather than
+// replicated.
+func TestReplica_Update_LogFailure(t *testing.T) {
+	dir := t.TempDir()
+
+	r := restart(t, dir)
+	increment(t, r, 2)
+	seq := r.seq
+
+	// Swap the log for a read-only handle so that appending fails.
+	f, err := os.Open(r.wal.path)
+	require.NoError(t, err)
+	require.NoError(t, r.wal.f.Close())
+	r.wal.f = f
+
+	require.Error(t, r.Update(func(c *crdt.GCounter) (crdt.StateCRDT, error) {
+		return c.Increment("n1", 3)
+	}))
+	require.Equal(t, 2, r.Value(), "failed change should be rolled back")
+	require.Equal(t, seq, r.seq, "failed change should not be replicated")
+	require.NoError(t, r.Close())
+
+	r = restart(t, dir)
+	require.Equal(t, 2, r.Value())
+}
+
+func TestReplica_Restore_TornRecord(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "n1.wal")
+	require.NoError(t, os.WriteFile(path, []byte(`{"n1":2}`+"\n"+`{"n1":5`), 0o644))
+
+	r := restart(t, dir)
+	require.Equal(t, 2, r.Value())
+}
+
+func TestReplica_Restore_Corrupt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "n1.wal")
+	require.NoError(t, os.WriteFile(path, []byte("garbage\n"+`{"n1":2}`+"\n"), 0o644))
+
+	n := maelstrom.NewNode()
+	n.Init("n1", []string{"n1"})
+	r := New(n, crdt.NewGCounter)
+	r.StateDir = dir
+	require.Error(t, r.restore())
+}
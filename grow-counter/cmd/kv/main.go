@@ -0,0 +1,40 @@
+// Command kv is a local stand-in for Maelstrom's lin-kv, seq-kv and lww-kv
+// services. It answers "read", "write", "cas" and "txn" requests on STDIN like
+// the service it is named after, so that a test harness can route messages
+// addressed to the service to it instead of running Maelstrom.
+//
+// The anomalies of seq-kv and lww-kv are driven by a random number generator
+// seeded with -seed, so a run can be reproduced from the seed it logs.
+package main
+
+import (
+	"flag"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/TropicalDog17/distributed/dis-sys-chall/go/grow-counter/ds"
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func main() {
+	service := flag.String("service", maelstrom.LinKV, "service to stand in for: lin-kv, seq-kv or lww-kv")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed of the anomalies of seq-kv and lww-kv")
+	flag.Parse()
+
+	// Services are never sent an "init" message, so replies are sent from
+	// the service name right away.
+	n := maelstrom.NewNode()
+	n.Init(*service, nil)
+	if _, err := ds.New(n, *service, rand.New(rand.NewSource(*seed))); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Standing in for %s with seed %d", *service, *seed)
+
+	// Execute the node's message loop. This will run until STDIN is closed.
+	if err := n.Run(); err != nil {
+		log.Printf("ERROR: %s", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+	"github.com/project3/crdt"
+	"github.com/project3/crdt/replica"
+)
+
+// addMessageBody represents the body for the "add" message. Delta may be negative.
+type addMessageBody struct {
+	maelstrom.MessageBody
+	Delta int `json:"delta"`
+}
+
+// readOKMessageBody represents the response body for the "read_ok" message.
+type readOKMessageBody struct {
+	maelstrom.MessageBody
+	Value any `json:"value"`
+}
+
+// Node is a PN-Counter replica running on top of a maelstrom.Node.
+type Node struct {
+	counter *replica.Replica[*crdt.PNCounter]
+
+	n *maelstrom.Node
+}
+
+// NewNode returns a new PN-Counter node with its handlers registered on n. Changes
+// are replicated according to config.
+func NewNode(n *maelstrom.Node, config replica.Config) (*Node, error) {
+	node := &Node{
+		counter: replica.New(n, crdt.NewPNCounter),
+		n:       n,
+	}
+	if err := node.counter.Configure(config); err != nil {
+		return nil, err
+	}
+	maelstrom.HandleTyped(n, "add", node.handleAdd)
+	n.Handle("read", node.handleRead)
+	return node, nil
+}
+
+func (node *Node) handleAdd(msg maelstrom.Message, body addMessageBody) (maelstrom.MessageBody, error) {
+	if err := node.counter.Update(func(c *crdt.PNCounter) (crdt.StateCRDT, error) {
+		return c.Add(node.n.ID(), body.Delta)
+	}); errors.Is(err, crdt.ErrDeltaOutOfRange) {
+		return maelstrom.MessageBody{}, maelstrom.NewRPCError(maelstrom.MalformedRequest, err.Error())
+	} else if err != nil {
+		return maelstrom.MessageBody{}, err
+	}
+	return maelstrom.MessageBody{Type: "add_ok"}, nil
+}
+
+func (node *Node) handleRead(msg maelstrom.Message) error {
+	return node.n.Reply(msg, readOKMessageBody{
+		MessageBody: maelstrom.MessageBody{Type: "read_ok"},
+		Value:       node.counter.Value(),
+	})
+}
+
+func main() {
+	config := replica.DefaultConfig()
+	if err := config.RegisterFlags(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+	flag.Parse()
+
+	n := maelstrom.NewNode()
+	node, err := NewNode(n, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Execute the node's message loop. This will run until STDIN is closed.
+	if err := n.Run(); err != nil {
+		log.Printf("ERROR: %s", err)
+		os.Exit(1)
+	}
+	if err := node.counter.Close(); err != nil {
+		log.Printf("ERROR: %s", err)
+		os.Exit(1)
+	}
+}
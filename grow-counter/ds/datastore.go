@@ -1,64 +1,206 @@
+// Package ds implements a local stand-in for Maelstrom's key/value services,
+// so that nodes built on maelstrom.KV can be run and tested without the
+// Maelstrom jar.
 package ds
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
 
-type Message struct {
-	Id   int            `json:"id"`
-	Src  string         `json:"src"`
-	Dest string         `json:"dest"`
-	Body map[string]any `json:"body"`
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// readMessageBody represents the body for the "read" message.
+type readMessageBody struct {
+	maelstrom.MessageBody
+	Key json.RawMessage `json:"key"`
+}
+
+// readOKMessageBody represents the response body for the "read_ok" message.
+type readOKMessageBody struct {
+	maelstrom.MessageBody
+	Value any `json:"value"`
+}
+
+// writeMessageBody represents the body for the "write" message.
+type writeMessageBody struct {
+	maelstrom.MessageBody
+	Key   json.RawMessage `json:"key"`
+	Value any             `json:"value"`
+}
+
+// casMessageBody represents the body for the "cas" message.
+type casMessageBody struct {
+	maelstrom.MessageBody
+	Key               json.RawMessage `json:"key"`
+	From              any             `json:"from"`
+	To                any             `json:"to"`
+	CreateIfNotExists bool            `json:"create_if_not_exists"`
 }
+
+// DataStore is an in-memory key/value store speaking the JSON protocol of
+// Maelstrom's key/value services: "read", "write" and "cas" requests,
+// answered with KeyDoesNotExist and PreconditionFailed errors like the real
+// services, and "txn" requests in the format of Maelstrom's txn-rw-register
+// and txn-list-append workloads. The consistency of the answers depends on
+// the service the store stands in for:
+//
+//   - lin-kv is linearizable: every operation takes effect atomically at some
+//     point between request and reply.
+//   - seq-kv is sequentially consistent: each client sees its own writes and
+//     never goes back in time, but may read arbitrarily stale values.
+//   - lww-kv keeps several replicas that resolve concurrent writes by
+//     timestamp, so writes can be lost and reads can be stale.
+//
+// Keys and values can be any JSON values. Keys, and the values compared by
+// "cas", are equal if they encode to the same JSON, so the integers 1 and 1.0
+// are the same key.
 type DataStore struct {
-	kv map[string]int
-}
-
-var nextResponseId = 0
-
-func (d DataStore) handle(message Message) Message {
-	nextResponseId += 1
-	response := Message{}
-	response.Src = message.Dest
-	response.Dest = message.Src
-	response.Id = nextResponseId
-	response.Body = message.Body
-	key, _ := message.Body["key"].(string)
-	switch message.Body["type"] {
-	case "read":
-		val, ok := d.kv[key]
-		if ok {
-			response.Body["type"] = "read_ok"
-			response.Body["value"] = val
-		} else {
-			response.Body["type"] = "error"
-		}
-	case "write":
-		d.kv[key], _ = message.Body["value"].(int)
-		message.Body["type"] = "write_ok"
-	case "cas":
-		// check if key exists
-		from := message.Body["from"].(int)
-		to := message.Body["to"].(int)
-		create_if_not_exists := message.Body["create_if_not_exists"].(bool)
-		val, key_exist := d.kv[key]
-		if key_exist {
-			if val == from {
-				d.kv[key] = to
-				response.Body["type"] = "cas_ok"
-			} else {
-				// Value not match
-				response.Body["type"] = "error"
-			}
-		} else {
-			if create_if_not_exists {
-				d.kv[key] = to
-				response.Body["type"] = "cas_ok"
-			} else {
-				response.Body["type"] = "error"
-			}
-		}
+	mu    sync.Mutex
+	store store
+
+	n *maelstrom.Node
+}
+
+// store holds the data of a DataStore. Clients are identified by the source
+// node of their requests. Implementations are not safe for concurrent use.
+type store interface {
+	read(client, key string) (any, error)
+	write(client, key string, value any)
+	cas(client, key string, from, to any, create bool) error
+	txn(client string, ops []microOp) error
+}
+
+// New returns an empty data store standing in for service, one of
+// maelstrom.LinKV, maelstrom.SeqKV or maelstrom.LWWKV, with its handlers
+// registered on n. rng drives the anomalies of seq-kv and lww-kv and may be
+// nil for lin-kv.
+func New(n *maelstrom.Node, service string, rng *rand.Rand) (*DataStore, error) {
+	d := &DataStore{n: n}
+	switch service {
+	case maelstrom.LinKV:
+		d.store = newLinStore()
+	case maelstrom.SeqKV:
+		d.store = newSeqStore(rng)
+	case maelstrom.LWWKV:
+		d.store = newLWWStore(rng)
+	default:
+		return nil, fmt.Errorf("unknown key/value service %q", service)
+	}
+
+	maelstrom.HandleTyped(n, "read", d.handleRead)
+	maelstrom.HandleTyped(n, "write", d.handleWrite)
+	maelstrom.HandleTyped(n, "cas", d.handleCAS)
+	maelstrom.HandleTyped(n, "txn", d.handleTxn)
+	return d, nil
+}
+
+func (d *DataStore) handleRead(msg maelstrom.Message, body readMessageBody) (readOKMessageBody, error) {
+	key, err := canonicalKey(body.Key)
+	if err != nil {
+		return readOKMessageBody{}, err
+	}
+
+	value, err := d.read(msg.Src, key)
+	if err != nil {
+		return readOKMessageBody{}, err
+	}
+	return readOKMessageBody{
+		MessageBody: maelstrom.MessageBody{Type: "read_ok"},
+		Value:       value,
+	}, nil
+}
+
+func (d *DataStore) handleWrite(msg maelstrom.Message, body writeMessageBody) (maelstrom.MessageBody, error) {
+	key, err := canonicalKey(body.Key)
+	if err != nil {
+		return maelstrom.MessageBody{}, err
+	}
+
+	d.write(msg.Src, key, body.Value)
+	return maelstrom.MessageBody{Type: "write_ok"}, nil
+}
+
+func (d *DataStore) handleCAS(msg maelstrom.Message, body casMessageBody) (maelstrom.MessageBody, error) {
+	key, err := canonicalKey(body.Key)
+	if err != nil {
+		return maelstrom.MessageBody{}, err
+	}
+
+	if err := d.cas(msg.Src, key, body.From, body.To, body.CreateIfNotExists); err != nil {
+		return maelstrom.MessageBody{}, err
+	}
+	return maelstrom.MessageBody{Type: "cas_ok"}, nil
+}
+
+func (d *DataStore) handleTxn(msg maelstrom.Message, body txnMessageBody) (txnOKMessageBody, error) {
+	ops, err := parseTxn(body.Txn)
+	if err != nil {
+		return txnOKMessageBody{}, err
+	}
+
+	if err := d.txn(msg.Src, ops); err != nil {
+		return txnOKMessageBody{}, err
+	}
+	return txnOKMessageBody{
+		MessageBody: maelstrom.MessageBody{Type: "txn_ok"},
+		Txn:         encodeTxn(ops),
+	}, nil
+}
+
+// read returns the value of key as seen by client.
+func (d *DataStore) read(client, key string) (any, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.store.read(client, key)
+}
+
+// write sets the value of key on behalf of client.
+func (d *DataStore) write(client, key string, value any) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.store.write(client, key, value)
+}
+
+// cas sets the value of key to to if its current value is from, on behalf of
+// client. If key does not exist, it is created with value to if create is
+// true.
+func (d *DataStore) cas(client, key string, from, to any, create bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.store.cas(client, key, from, to, create)
+}
+
+// txn applies ops atomically on behalf of client, filling in the values of
+// their reads.
+func (d *DataStore) txn(client string, ops []microOp) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.store.txn(client, ops)
+}
+
+// canonicalKey returns the canonical JSON encoding of the key in a request.
+func canonicalKey(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 {
+		return "", maelstrom.NewRPCError(maelstrom.MalformedRequest, "missing key")
+	}
+	var key any
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return "", maelstrom.NewRPCError(maelstrom.MalformedRequest, err.Error())
 	}
-	return response
+	return encode(key), nil
 }
-func main() {
-	fmt.Println("Hello world!")
+
+// jsonEqual reports whether a and b, values decoded from JSON, are equal.
+func jsonEqual(a, b any) bool {
+	return encode(a) == encode(b)
+}
+
+// encode returns the JSON encoding of v, a value decoded from JSON. Object
+// keys are sorted, so equal values have equal encodings.
+func encode(v any) string {
+	buf, _ := json.Marshal(v) // values decoded from JSON always encode
+	return string(buf)
 }
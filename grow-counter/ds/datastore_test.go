@@ -1,141 +1,187 @@
 package ds
 
 import (
+	"context"
+	"encoding/json"
+	"io"
 	"testing"
+	"time"
 
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
 	"github.com/stretchr/testify/assert"
 )
 
-func get_initial_ds() DataStore {
-	ds := DataStore{}
-	ds.kv = map[string]int{
+// connect returns a lin-kv client for a node n1 whose messages are answered
+// by ds.
+func connect(t *testing.T, ds *DataStore) *maelstrom.KV {
+	t.Helper()
+	return maelstrom.NewLinKV(connectNode(t, ds))
+}
+
+// connectNode returns a node n1 whose messages are answered by ds.
+func connectNode(t *testing.T, ds *DataStore) *maelstrom.Node {
+	t.Helper()
+	toStore, fromClient := io.Pipe()
+	toClient, fromStore := io.Pipe()
+	ds.n.Stdin, ds.n.Stdout = toStore, fromStore
+
+	client := maelstrom.NewNode()
+	client.Init("n1", []string{"n1"})
+	client.Stdin, client.Stdout = toClient, fromClient
+
+	go ds.n.Run()
+	go client.Run()
+	t.Cleanup(func() {
+		fromClient.Close()
+		fromStore.Close()
+	})
+	return client
+}
+
+func get_initial_ds(t *testing.T) *DataStore {
+	n := maelstrom.NewNode()
+	n.Init(maelstrom.LinKV, nil)
+	ds, err := New(n, maelstrom.LinKV, nil)
+	assert.NoError(t, err)
+	for key, value := range map[string]int{
 		"a": 12,
 		"b": 34,
 		"c": 56,
 		"d": 78,
 		"e": 910,
+	} {
+		ds.write("", encode(key), value)
 	}
 	return ds
 }
+
+func newContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
 func TestHandleReadData(t *testing.T) {
-	ds := get_initial_ds()
-	// Id   int            `json:"id"`
-	// Src  string         `json:"src"`
-	// Dest string         `json:"dest"`
-	// Body map[string]any `json:"body"`
-	msg := Message{
-		Id:   1,
-		Src:  "n0",
-		Dest: "n2",
-		Body: map[string]any{
-			"type": "read",
-			"key":  "a",
-		},
-	}
-	response := ds.handle(msg)
-	assert.Equal(t, response.Body["type"], "read_ok", "Should be ok")
-	assert.Equal(t, response.Body["value"], 12, "Should pass")
+	kv := connect(t, get_initial_ds(t))
+	ctx := newContext(t)
 
+	value, err := kv.ReadInt(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, 12, value, "Should pass")
+
+	// Non existing key
+	_, err = kv.Read(ctx, "f")
+	assert.Equal(t, maelstrom.KeyDoesNotExist, maelstrom.ErrorCode(err))
 }
+
 func TestHandleWriteData(t *testing.T) {
-	ds := get_initial_ds()
-	msg := Message{
-		Id:   1,
-		Src:  "n0",
-		Dest: "n2",
-		Body: map[string]any{
-			"type":  "write",
-			"key":   "a",
-			"value": 34,
-		},
-	}
-	response := ds.handle(msg)
-	assert.Equal(t, response.Body["type"], "write_ok", "Should be ok")
-	assert.Equal(t, response.Body["value"], 34, "Should pass")
-	assert.Equal(t, ds.kv["a"], 34, "should equals")
+	ds := get_initial_ds(t)
+	kv := connect(t, ds)
+	ctx := newContext(t)
+
+	assert.NoError(t, kv.Write(ctx, "a", 34))
+	value, err := kv.ReadInt(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, 34, value, "should equals")
+
 	// Non existing key
-	msg = Message{
-		Id:   1,
-		Src:  "n0",
-		Dest: "n2",
-		Body: map[string]any{
-			"type":  "write",
-			"key":   "f",
-			"value": 34,
-		},
-	}
-	response = ds.handle(msg)
-	assert.Equal(t, response.Body["type"], "write_ok", "Should be ok")
-	assert.Equal(t, response.Body["value"], 34, "Should pass")
-	assert.Equal(t, ds.kv["f"], 34, "should equals")
+	assert.NoError(t, kv.Write(ctx, "f", 34))
+	value, err = kv.ReadInt(ctx, "f")
+	assert.NoError(t, err)
+	assert.Equal(t, 34, value, "should equals")
+
+	// Values are arbitrary JSON.
+	assert.NoError(t, kv.Write(ctx, "g", []any{"x", 1.5}))
+	list, err := kv.Read(ctx, "g")
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"x", 1.5}, list)
 }
+
 func TestHandleCas(t *testing.T) {
-	ds := get_initial_ds()
-	msg := Message{
-		Id:   1,
-		Src:  "n0",
-		Dest: "n2",
-		Body: map[string]any{
-			"type":                 "cas",
-			"key":                  "a",
-			"from":                 12,
-			"to":                   34,
-			"create_if_not_exists": false,
-		},
-	}
-	response := ds.handle(msg)
-	assert.Equal(t, response.Body["type"], "cas_ok", "Should be ok")
-	assert.Equal(t, ds.kv["a"], 34, "should equals")
+	kv := connect(t, get_initial_ds(t))
+	ctx := newContext(t)
+
+	assert.NoError(t, kv.CompareAndSwap(ctx, "a", 12, 34, false))
+	value, err := kv.ReadInt(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, 34, value, "should equals")
 
 	// Test mismatch from value
-	ds = get_initial_ds()
-	msg = Message{
-		Id:   1,
-		Src:  "n0",
-		Dest: "n2",
-		Body: map[string]any{
-			"type":                 "cas",
-			"key":                  "a",
-			"from":                 13,
-			"to":                   34,
-			"create_if_not_exists": false,
-		},
-	}
-	response = ds.handle(msg)
-	assert.Equal(t, response.Body["type"], "error")
+	err = kv.CompareAndSwap(ctx, "b", 13, 35, false)
+	assert.Equal(t, maelstrom.PreconditionFailed, maelstrom.ErrorCode(err))
 
 	// Test key not exist, create_if_not_exists = false
-	ds = get_initial_ds()
-	msg = Message{
-		Id:   1,
-		Src:  "n0",
-		Dest: "n2",
-		Body: map[string]any{
-			"type":                 "cas",
-			"key":                  "dsl",
-			"from":                 13,
-			"to":                   34,
-			"create_if_not_exists": false,
-		},
-	}
-	response = ds.handle(msg)
-	assert.Equal(t, response.Body["type"], "error")
+	err = kv.CompareAndSwap(ctx, "dsl", 13, 34, false)
+	assert.Equal(t, maelstrom.KeyDoesNotExist, maelstrom.ErrorCode(err))
+
 	// Test key not exist, create_if_not_exists = true
-	ds = get_initial_ds()
-	msg = Message{
-		Id:   1,
-		Src:  "n0",
-		Dest: "n2",
-		Body: map[string]any{
-			"type":                 "cas",
-			"key":                  "dsl",
-			"from":                 13,
-			"to":                   34,
-			"create_if_not_exists": true,
-		},
+	assert.NoError(t, kv.CompareAndSwap(ctx, "dsl", 13, 34, true))
+	value, err = kv.ReadInt(ctx, "dsl")
+	assert.NoError(t, err)
+	assert.Equal(t, 34, value, "should equals")
+
+	// Numbers compare by value, however they are encoded.
+	assert.NoError(t, kv.CompareAndSwap(ctx, "c", 56.0, 57, false))
+}
+
+func TestHandleMalformed(t *testing.T) {
+	ds := get_initial_ds(t)
+	_, err := canonicalKey(nil)
+	assert.Equal(t, maelstrom.MalformedRequest, maelstrom.ErrorCode(err))
+
+	// Keys that encode the same JSON value are the same key.
+	ds.write("", encode(1.0), "one")
+	key, err := canonicalKey([]byte(`1`))
+	assert.NoError(t, err)
+	value, err := ds.read("", key)
+	assert.NoError(t, err)
+	assert.Equal(t, "one", value)
+}
+
+func TestNewUnknownService(t *testing.T) {
+	_, err := New(maelstrom.NewNode(), "fast-kv", nil)
+	assert.Error(t, err)
+}
+
+func TestHandleTxn(t *testing.T) {
+	n := connectNode(t, get_initial_ds(t))
+	ctx := newContext(t)
+
+	txn := func(ops string) (string, error) {
+		resp, err := n.SyncRPC(ctx, maelstrom.LinKV, map[string]any{
+			"type": "txn",
+			"txn":  json.RawMessage(ops),
+		})
+		if err != nil {
+			return "", err
+		}
+		var body struct {
+			Txn json.RawMessage `json:"txn"`
+		}
+		assert.NoError(t, json.Unmarshal(resp.Body, &body))
+		return string(body.Txn), nil
 	}
-	response = ds.handle(msg)
-	assert.Equal(t, response.Body["type"], "cas_ok", "Should be ok")
-	assert.Equal(t, ds.kv["dsl"], 34, "should equals")
 
+	// txn-rw-register: reads see the state before the transaction and its
+	// own earlier writes.
+	got, err := txn(`[["r", "a", null], ["w", "a", 13], ["r", "a", null], ["r", "x", null]]`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[["r", "a", 12], ["w", "a", 13], ["r", "a", 13], ["r", "x", null]]`, got)
+
+	// txn-list-append, with integer keys.
+	got, err = txn(`[["append", 1, 5], ["append", 1, 6], ["r", 1, null]]`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[["append", 1, 5], ["append", 1, 6], ["r", 1, [5, 6]]]`, got)
+
+	// A failing micro-op aborts the whole transaction.
+	_, err = txn(`[["w", "b", 1], ["append", "a", 1]]`)
+	assert.Equal(t, maelstrom.PreconditionFailed, maelstrom.ErrorCode(err))
+	got, err = txn(`[["r", "b", null]]`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[["r", "b", 34]]`, got)
+
+	for _, ops := range []string{`[["r", "a"]]`, `[["inc", "a", 1]]`, `[[1, "a", 1]]`} {
+		_, err = txn(ops)
+		assert.Equal(t, maelstrom.MalformedRequest, maelstrom.ErrorCode(err), ops)
+	}
 }
@@ -0,0 +1,301 @@
+package ds
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// linStore is a linearizable store: a single map that every operation reads
+// and writes directly.
+type linStore struct {
+	kv map[string]any
+}
+
+func newLinStore() *linStore {
+	return &linStore{kv: make(map[string]any)}
+}
+
+func (s *linStore) read(client, key string) (any, error) {
+	value, ok := s.kv[key]
+	if !ok {
+		return nil, errKeyDoesNotExist()
+	}
+	return value, nil
+}
+
+func (s *linStore) write(client, key string, value any) {
+	s.kv[key] = value
+}
+
+func (s *linStore) cas(client, key string, from, to any, create bool) error {
+	value, ok := s.kv[key]
+	if err := checkCAS(value, ok, from, create); err != nil {
+		return err
+	}
+	s.kv[key] = to
+	return nil
+}
+
+func (s *linStore) txn(client string, ops []microOp) error {
+	writes, err := execTxn(ops, func(key string) (any, bool) {
+		value, ok := s.kv[key]
+		return value, ok
+	})
+	if err != nil {
+		return err
+	}
+	for key, value := range writes {
+		s.kv[key] = value
+	}
+	return nil
+}
+
+// seqStore is a sequentially consistent store. Every write is appended to a
+// single history, and each client reads the store as of some position in the
+// history. A read moves the client's position forward by a random amount, up
+// to the end of the history, so clients may read stale values but never go
+// back in time. Writes and swaps apply at the end of the history and move the
+// client there, so clients always see their own writes. All the writes of a
+// transaction share a single position, so no read observes part of one.
+//
+// Clients start at the beginning of the history, like a fresh client of
+// Maelstrom's seq-kv may observe an empty store. The history is never
+// truncated.
+type seqStore struct {
+	rng *rand.Rand
+
+	// pos is the position of the last write, starting from 1.
+	pos int
+
+	// versions holds the values written to each key in history order.
+	versions map[string][]version
+
+	// clients holds the position each client last observed.
+	clients map[string]int
+}
+
+// version is a value written to a key at a position in the history.
+type version struct {
+	pos   int
+	value any
+}
+
+func newSeqStore(rng *rand.Rand) *seqStore {
+	return &seqStore{
+		rng:      rng,
+		versions: make(map[string][]version),
+		clients:  make(map[string]int),
+	}
+}
+
+func (s *seqStore) read(client, key string) (any, error) {
+	from := s.clients[client]
+	pos := from + s.rng.Intn(s.pos-from+1)
+	s.clients[client] = pos
+
+	// Find the last version written at or before pos.
+	versions := s.versions[key]
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].pos > pos })
+	if i == 0 {
+		return nil, errKeyDoesNotExist()
+	}
+	return versions[i-1].value, nil
+}
+
+func (s *seqStore) write(client, key string, value any) {
+	s.pos++
+	s.versions[key] = append(s.versions[key], version{pos: s.pos, value: value})
+	s.clients[client] = s.pos
+}
+
+func (s *seqStore) cas(client, key string, from, to any, create bool) error {
+	// A swap reads the latest value, so the client is up to date afterwards
+	// whether or not it succeeds.
+	s.clients[client] = s.pos
+
+	var value any
+	versions := s.versions[key]
+	if len(versions) > 0 {
+		value = versions[len(versions)-1].value
+	}
+	if err := checkCAS(value, len(versions) > 0, from, create); err != nil {
+		return err
+	}
+	s.write(client, key, to)
+	return nil
+}
+
+// txn runs a transaction against the latest state, like a swap.
+func (s *seqStore) txn(client string, ops []microOp) error {
+	s.clients[client] = s.pos
+
+	writes, err := execTxn(ops, func(key string) (any, bool) {
+		versions := s.versions[key]
+		if len(versions) == 0 {
+			return nil, false
+		}
+		return versions[len(versions)-1].value, true
+	})
+	if err != nil || len(writes) == 0 {
+		return err
+	}
+
+	s.pos++
+	for key, value := range writes {
+		s.versions[key] = append(s.versions[key], version{pos: s.pos, value: value})
+	}
+	s.clients[client] = s.pos
+	return nil
+}
+
+// Shape of an lwwStore: the number of replicas, and the maximum skew of a
+// replica's clock ahead of the true time.
+const (
+	lwwReplicas = 3
+	lwwMaxSkew  = 5
+)
+
+// lwwStore is a last-write-wins store made of replicas that each apply
+// operations locally. Every write is stamped with the writing replica's
+// clock, which runs ahead of the true time by a fixed random skew, and
+// replicas keep the value with the highest timestamp when they exchange
+// state. A write on a replica whose clock lags another's can therefore be
+// overwritten by an earlier write, or be dropped straight away. Replicas
+// exchange state at random after operations, so reads can be stale.
+type lwwStore struct {
+	rng      *rand.Rand
+	now      int
+	replicas []*lwwReplica
+}
+
+// lwwReplica is a replica of an lwwStore.
+type lwwReplica struct {
+	skew int
+	kv   map[string]stamped
+}
+
+// stamped is a value written at a timestamp. Ties between timestamps are
+// broken by the index of the writing replica.
+type stamped struct {
+	value   any
+	ts      int
+	replica int
+}
+
+// newer reports whether v wins over w.
+func (v stamped) newer(w stamped) bool {
+	return v.ts > w.ts || (v.ts == w.ts && v.replica > w.replica)
+}
+
+func newLWWStore(rng *rand.Rand) *lwwStore {
+	s := &lwwStore{rng: rng}
+	for i := 0; i < lwwReplicas; i++ {
+		s.replicas = append(s.replicas, &lwwReplica{
+			skew: rng.Intn(lwwMaxSkew + 1),
+			kv:   make(map[string]stamped),
+		})
+	}
+	return s
+}
+
+func (s *lwwStore) read(client, key string) (any, error) {
+	defer s.gossip()
+	v, ok := s.replicas[s.rng.Intn(len(s.replicas))].kv[key]
+	if !ok {
+		return nil, errKeyDoesNotExist()
+	}
+	return v.value, nil
+}
+
+func (s *lwwStore) write(client, key string, value any) {
+	defer s.gossip()
+	s.put(s.rng.Intn(len(s.replicas)), key, value)
+}
+
+func (s *lwwStore) cas(client, key string, from, to any, create bool) error {
+	defer s.gossip()
+	i := s.rng.Intn(len(s.replicas))
+	v, ok := s.replicas[i].kv[key]
+	if err := checkCAS(v.value, ok, from, create); err != nil {
+		return err
+	}
+	s.put(i, key, to)
+	return nil
+}
+
+// txn runs a transaction on a random replica. Its writes share a single
+// timestamp, but may still be partly overwritten by other writes.
+func (s *lwwStore) txn(client string, ops []microOp) error {
+	defer s.gossip()
+	i := s.rng.Intn(len(s.replicas))
+	writes, err := execTxn(ops, func(key string) (any, bool) {
+		v, ok := s.replicas[i].kv[key]
+		return v.value, ok
+	})
+	if err != nil {
+		return err
+	}
+	s.putAll(i, writes)
+	return nil
+}
+
+// put writes value to key on replica i, unless the replica already holds a
+// newer value.
+func (s *lwwStore) put(i int, key string, value any) {
+	s.putAll(i, map[string]any{key: value})
+}
+
+// putAll writes every value in writes to its key on replica i with a single
+// timestamp, unless the replica already holds a newer value.
+func (s *lwwStore) putAll(i int, writes map[string]any) {
+	s.now++
+	r := s.replicas[i]
+	for key, value := range writes {
+		v := stamped{value: value, ts: s.now + r.skew, replica: i}
+		if old, ok := r.kv[key]; !ok || v.newer(old) {
+			r.kv[key] = v
+		}
+	}
+}
+
+// gossip makes a random pair of replicas exchange state half of the time.
+func (s *lwwStore) gossip() {
+	if s.rng.Intn(2) == 0 {
+		return
+	}
+	a := s.replicas[s.rng.Intn(len(s.replicas))]
+	b := s.replicas[s.rng.Intn(len(s.replicas))]
+	a.merge(b)
+	b.merge(a)
+}
+
+// merge copies every value of other that is newer than the replica's.
+func (r *lwwReplica) merge(other *lwwReplica) {
+	for key, v := range other.kv {
+		if old, ok := r.kv[key]; !ok || v.newer(old) {
+			r.kv[key] = v
+		}
+	}
+}
+
+// errKeyDoesNotExist returns the error for reading a missing key.
+func errKeyDoesNotExist() error {
+	return maelstrom.NewRPCError(maelstrom.KeyDoesNotExist, "key does not exist")
+}
+
+// checkCAS returns the error for a "cas" from from on a key with the given
+// current value, or nil if the swap can go ahead.
+func checkCAS(value any, ok bool, from any, create bool) error {
+	if !ok {
+		if !create {
+			return errKeyDoesNotExist()
+		}
+	} else if !jsonEqual(value, from) {
+		return maelstrom.NewRPCError(maelstrom.PreconditionFailed,
+			fmt.Sprintf("expected %s, but had %s", encode(from), encode(value)))
+	}
+	return nil
+}
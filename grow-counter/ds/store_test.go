@@ -0,0 +1,122 @@
+package ds
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeqStore(t *testing.T) {
+	s := newSeqStore(rand.New(rand.NewSource(1)))
+	for i := 1; i <= 100; i++ {
+		s.write("c1", "k", i)
+
+		// A client always sees its own writes.
+		value, err := s.read("c1", "k")
+		assert.NoError(t, err)
+		assert.Equal(t, i, value)
+	}
+
+	// Another client reads stale values, but never goes back in time.
+	var stale bool
+	last := 0
+	for i := 0; i < 100; i++ {
+		value, err := s.read("c2", "k")
+		if maelstrom.ErrorCode(err) == maelstrom.KeyDoesNotExist {
+			assert.Zero(t, last, "key should not disappear once read")
+			stale = true
+			continue
+		}
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, value.(int), last)
+		stale = stale || value.(int) < 100
+		last = value.(int)
+	}
+	assert.True(t, stale, "expected some stale reads")
+	assert.Equal(t, 100, last, "reads should eventually catch up")
+
+	// Swaps always apply to the latest value.
+	assert.NoError(t, s.cas("c3", "k", 100, 101, false))
+	err := s.cas("c3", "k", 100, 102, false)
+	assert.Equal(t, maelstrom.PreconditionFailed, maelstrom.ErrorCode(err))
+	err = s.cas("c3", "other", 0, 1, false)
+	assert.Equal(t, maelstrom.KeyDoesNotExist, maelstrom.ErrorCode(err))
+}
+
+func TestLWWStore(t *testing.T) {
+	s := newLWWStore(rand.New(rand.NewSource(1)))
+	written := make(map[int]bool)
+	for i := 1; i <= 100; i++ {
+		s.write("c1", "k", i)
+		written[i] = true
+	}
+
+	// Once every replica has exchanged state they agree on one of the
+	// written values, which need not be the last one.
+	for i := range s.replicas {
+		for j := range s.replicas {
+			s.replicas[i].merge(s.replicas[j])
+		}
+	}
+	value, err := s.read("c1", "k")
+	assert.NoError(t, err)
+	assert.True(t, written[value.(int)])
+	for _, r := range s.replicas {
+		assert.Equal(t, value, r.kv["k"].value)
+	}
+}
+
+func TestLWWStore_LostWrite(t *testing.T) {
+	// Seeded so that some replica's clock lags another's: a write through it
+	// right after a write through the other is lost.
+	rng := rand.New(rand.NewSource(1))
+	s := newLWWStore(rng)
+	var lo, hi int
+	for i, r := range s.replicas {
+		if r.skew < s.replicas[lo].skew {
+			lo = i
+		}
+		if r.skew > s.replicas[hi].skew {
+			hi = i
+		}
+	}
+	assert.Less(t, s.replicas[lo].skew, s.replicas[hi].skew)
+
+	s.put(hi, "k", "first")
+	s.put(lo, "k", "second")
+	s.replicas[lo].merge(s.replicas[hi])
+	assert.Equal(t, "first", s.replicas[lo].kv["k"].value, "the later write should be lost")
+}
+
+func TestSeqStore_Txn(t *testing.T) {
+	s := newSeqStore(rand.New(rand.NewSource(1)))
+	for i := 1; i <= 50; i++ {
+		ops, err := parseTxn([][]json.RawMessage{
+			{[]byte(`"w"`), []byte(`"x"`), []byte(fmt.Sprint(i))},
+			{[]byte(`"w"`), []byte(`"y"`), []byte(fmt.Sprint(i))},
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, s.txn("c1", ops))
+	}
+
+	// The writes of a transaction share a position in the history, so no
+	// read position observes half of one.
+	xs, ys := s.versions[encode("x")], s.versions[encode("y")]
+	assert.Len(t, ys, len(xs))
+	for i := range xs {
+		assert.Equal(t, xs[i].pos, ys[i].pos)
+	}
+
+	ops, err := parseTxn([][]json.RawMessage{
+		{[]byte(`"r"`), []byte(`"x"`), []byte(`null`)},
+		{[]byte(`"r"`), []byte(`"y"`), []byte(`null`)},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, s.txn("c2", ops))
+	assert.Equal(t, 50.0, ops[0].value)
+	assert.Equal(t, 50.0, ops[1].value)
+}
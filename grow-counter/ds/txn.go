@@ -0,0 +1,116 @@
+package ds
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// txnMessageBody represents the body for the "txn" message. Each micro-op is
+// an array of [op, key, value] where op is "r", "w" or "append".
+type txnMessageBody struct {
+	maelstrom.MessageBody
+	Txn [][]json.RawMessage `json:"txn"`
+}
+
+// txnOKMessageBody represents the response body for the "txn_ok" message,
+// which carries the micro-ops of the request with the values of the reads
+// filled in.
+type txnOKMessageBody struct {
+	maelstrom.MessageBody
+	Txn [][]any `json:"txn"`
+}
+
+// microOp is a single operation of a transaction:
+//
+//   - "r" reads the value of key, which is null if key does not exist.
+//   - "w" sets the value of key, as in txn-rw-register.
+//   - "append" appends value to the list stored under key, creating it if
+//     key does not exist, as in txn-list-append.
+type microOp struct {
+	op string
+
+	// rawKey is the key as sent by the client, key its canonical encoding.
+	rawKey json.RawMessage
+	key    string
+
+	value any
+}
+
+// parseTxn parses the micro-ops of a "txn" request.
+func parseTxn(txn [][]json.RawMessage) ([]microOp, error) {
+	ops := make([]microOp, len(txn))
+	for i, raw := range txn {
+		if len(raw) != 3 {
+			return nil, maelstrom.NewRPCError(maelstrom.MalformedRequest,
+				fmt.Sprintf("micro-op %d: want [op, key, value], got %d elements", i, len(raw)))
+		}
+
+		op := &ops[i]
+		if err := json.Unmarshal(raw[0], &op.op); err != nil {
+			return nil, maelstrom.NewRPCError(maelstrom.MalformedRequest, fmt.Sprintf("micro-op %d: %s", i, err))
+		}
+		switch op.op {
+		case "r", "w", "append":
+		default:
+			return nil, maelstrom.NewRPCError(maelstrom.MalformedRequest, fmt.Sprintf("micro-op %d: unknown op %q", i, op.op))
+		}
+
+		key, err := canonicalKey(raw[1])
+		if err != nil {
+			return nil, err
+		}
+		op.rawKey, op.key = raw[1], key
+
+		if err := json.Unmarshal(raw[2], &op.value); err != nil {
+			return nil, maelstrom.NewRPCError(maelstrom.MalformedRequest, fmt.Sprintf("micro-op %d: %s", i, err))
+		}
+	}
+	return ops, nil
+}
+
+// encodeTxn returns the micro-ops in the wire format of a "txn_ok" reply.
+func encodeTxn(ops []microOp) [][]any {
+	txn := make([][]any, len(ops))
+	for i, op := range ops {
+		txn[i] = []any{op.op, op.rawKey, op.value}
+	}
+	return txn
+}
+
+// execTxn runs ops against the state returned by get, filling in the values
+// of reads. Writes are not applied but returned, keyed by key, so that the
+// caller can apply them all at once. Reads observe the writes of earlier
+// micro-ops in the same transaction. Returns an error without any writes if
+// a micro-op cannot be applied.
+func execTxn(ops []microOp, get func(key string) (any, bool)) (map[string]any, error) {
+	writes := make(map[string]any)
+	read := func(key string) (any, bool) {
+		if v, ok := writes[key]; ok {
+			return v, true
+		}
+		return get(key)
+	}
+
+	for i := range ops {
+		op := &ops[i]
+		switch op.op {
+		case "r":
+			op.value, _ = read(op.key)
+		case "w":
+			writes[op.key] = op.value
+		case "append":
+			current, ok := read(op.key)
+			list, isList := current.([]any)
+			if ok && !isList {
+				return nil, maelstrom.NewRPCError(maelstrom.PreconditionFailed,
+					fmt.Sprintf("cannot append to %s", encode(current)))
+			}
+			// Copy the list, which may be shared with older versions.
+			writes[op.key] = append(slices.Clip(list), op.value)
+		}
+	}
+	return writes, nil
+}
@@ -1,214 +1,108 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
-	"fmt"
+	"errors"
+	"flag"
+	"log"
 	"os"
-	"sync"
-	"time"
 
-	"golang.org/x/exp/slices"
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+	"github.com/project3/crdt"
+	"github.com/project3/crdt/replica"
 )
 
-type Request struct {
-	Id   int    `json:"id"`
-	Src  string `json:"src"`
-	Dest string `json:"dest"`
-	Body any    `json:"body"`
+// addMessageBody represents the body for the "add" message.
+type addMessageBody struct {
+	maelstrom.MessageBody
+	Delta int `json:"delta"`
 }
-type Response struct {
-	Src  string `json:"src"`
-	Dest string `json:"dest"`
-	Body any    `json:"body"`
-}
-
-const NODE_COUNT = 30
 
-var nextMsgId = 0
+// readOKMessageBody represents the response body for the "read_ok" message.
+type readOKMessageBody struct {
+	maelstrom.MessageBody
+	Value any `json:"value"`
+}
 
+// Node is a G-Counter replica running on top of a maelstrom.Node.
 type Node struct {
-	payloadMutex   sync.Mutex
-	nextMsgIdMutex sync.Mutex
-	payload        map[string]float64
-	nodeId         string
-	nodeIds        []string
+	counter *replica.Replica[*crdt.GCounter]
+
+	n *maelstrom.Node
 }
 
-func NewNode(nodeCount float64) (*Node, error) {
+// NewNode returns a new G-Counter node with its handlers registered on n. Changes
+// are replicated according to config.
+func NewNode(n *maelstrom.Node, config replica.Config) (*Node, error) {
 	node := &Node{
-		payload: make(map[string]float64),
+		counter: replica.New(n, crdt.NewGCounter),
+		n:       n,
+	}
+	if err := node.counter.Configure(config); err != nil {
+		return nil, err
 	}
+	maelstrom.HandleTyped(n, "add", node.handleAdd)
+	n.Handle("read", node.handleRead)
 	return node, nil
 }
 
-func (node *Node) increment(delta float64) {
-	node.replace(node.nodeId, node.payload[node.nodeId]+delta)
-}
-func (node *Node) localCounter() float64 {
-	var localCounter float64 = 0
-	for _, v := range node.payload {
-		localCounter += v
-	}
-	return localCounter
-}
-func (node *Node) replace(nodeId string, value float64) {
-	node.payloadMutex.Lock()
-	defer node.payloadMutex.Unlock()
-	node.payload[nodeId] = value
-}
-func (node *Node) merge(payload map[string]float64) {
-	for nodeId := range node.payload {
-		if node.payload[nodeId] < payload[nodeId] {
-			fmt.Fprintf(os.Stderr, "Receive value %v greater than local value %v, process to replace", node.payload[nodeId], payload[nodeId])
-			node.replace(nodeId, payload[nodeId])
-		}
+func (node *Node) handleAdd(msg maelstrom.Message, body addMessageBody) (maelstrom.MessageBody, error) {
+	if err := node.counter.Update(func(c *crdt.GCounter) (crdt.StateCRDT, error) {
+		return c.Increment(node.n.ID(), body.Delta)
+	}); errors.Is(err, crdt.ErrNegativeDelta) {
+		return maelstrom.MessageBody{}, maelstrom.NewRPCError(maelstrom.MalformedRequest, err.Error())
+	} else if err != nil {
+		return maelstrom.MessageBody{}, err
 	}
+	return maelstrom.MessageBody{Type: "add_ok"}, nil
 }
 
-func (node *Node) handle(msgType string, req Request) error {
-	body := req.Body.(map[string]any)
-	switch msgType {
-	case "init":
-		{
-			node.nodeId = body["node_id"].(string)
-			raw_nodeIds := body["node_ids"].([]any)
-			for _, id := range raw_nodeIds {
-				node.nodeIds = append(node.nodeIds, id.(string))
-			}
-
-			// Initialize local counter
-			for _, nodeId := range node.nodeIds {
-				node.payload[nodeId] = 0
-			}
-			body["type"] = "init_ok"
-			node.reply(req, body)
-			node.periodic()
-			fmt.Fprintf(os.Stderr, "Node %s initialized", node.nodeId)
-		}
-	case "add":
-		{
-			delta := body["delta"].(float64)
-			node.increment(delta)
-			body["type"] = "add_ok"
-			delete(body, "delta")
-			node.reply(req, body)
-			fmt.Fprintf(os.Stderr, "Add %v to node %s\n", delta, node.nodeId)
-		}
-	case "read":
-		{
-
-			body["type"] = "read_ok"
-			body["value"] = node.localCounter()
-			node.reply(req, body)
-			fmt.Fprintf(os.Stderr, "Read result from node %s\n", node.nodeId)
-		}
-	case "replicate":
-		{
-			from := req.Src
-			body := req.Body.(map[string]any)
-			raw_payload := body["value"].(map[string]any)
-			payload := make(map[string]float64, 0)
-			if len(raw_payload) != 0 {
-				for k, v := range raw_payload {
-					payload[k] = v.(float64)
-				}
-			}
-			fmt.Fprintf(os.Stderr, "Receive payload %v \n", payload)
-			node.merge(payload)
-			fmt.Fprintf(os.Stderr, "Done replicating result from node %s to node %s\n", from, node.nodeId)
-		}
-
-	}
-	return nil
+func (node *Node) handleRead(msg maelstrom.Message) error {
+	return node.n.Reply(msg, readOKMessageBody{
+		MessageBody: maelstrom.MessageBody{Type: "read_ok"},
+		Value:       node.counter.Value(),
+	})
 }
-func (node *Node) reply(req Request, reqBody map[string]any) {
-	body := req.Body.(map[string]any)
 
-	reqBody["in_reply_to"] = body["msg_id"]
-
-	node.send(req.Src, reqBody)
-}
-func (node *Node) send(dest string, body any) {
-	res := Response{
-		Src:  node.nodeId,
-		Dest: dest,
-		Body: body,
+func main() {
+	backend := flag.String("backend", envOr("COUNTER_BACKEND", "gossip"),
+		"where the counter is kept: gossip, to replicate it between nodes, or seq-kv (env COUNTER_BACKEND)")
+	config := replica.DefaultConfig()
+	if err := config.RegisterFlags(flag.CommandLine); err != nil {
+		log.Fatal(err)
 	}
+	flag.Parse()
 
-	jsonBytes, err := json.Marshal(res)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error marshaling request: %s for %v", err, res)
-		return
+	n := maelstrom.NewNode()
+	closeNode := func() error { return nil }
+	switch *backend {
+	case "gossip":
+		node, err := NewNode(n, config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		closeNode = node.counter.Close
+	case maelstrom.SeqKV:
+		NewKVNode(n)
+	default:
+		log.Fatalf("unknown backend %q", *backend)
 	}
-	fmt.Fprintln(os.Stdout, string(jsonBytes))
-}
-func (node *Node) increaseMsgId() {
-	node.nextMsgIdMutex.Lock()
-	defer node.nextMsgIdMutex.Unlock()
-	nextMsgId += 1
-
-}
-func (node *Node) reqReplication(other_nid string) error {
-	node.increaseMsgId()
-	if !slices.Contains(node.nodeIds, other_nid) {
-		return fmt.Errorf("error attempting connect to disconnected peer")
 
+	// Execute the node's message loop. This will run until STDIN is closed.
+	if err := n.Run(); err != nil {
+		log.Printf("ERROR: %s", err)
+		os.Exit(1)
 	}
-	body := make(map[string]any)
-	body["type"] = "replicate"
-	body["value"] = node.payload
-	req := Request{
-		Id:   nextMsgId,
-		Src:  node.nodeId,
-		Dest: other_nid,
-		Body: body,
-	}
-
-	jsonBytes, err := json.Marshal(req)
-	if err != nil {
-		return fmt.Errorf("error when marshaling replication request: %s for %v", err, req)
+	if err := closeNode(); err != nil {
+		log.Printf("ERROR: %s", err)
+		os.Exit(1)
 	}
-	fmt.Fprintln(os.Stdout, string(jsonBytes))
-	return nil
 }
 
-// a node will send replicating req periodically.
-func (node *Node) periodic() {
-	go func() {
-		for {
-			for _, other := range node.nodeIds {
-				if other == node.nodeId {
-					continue
-				}
-				node.reqReplication(other)
-			}
-			time.Sleep(3 * time.Second)
-		}
-	}()
-}
-
-//	func (n *Node) periodic() {
-//		for _, node := range node.nodeIds {
-//			node.merge()
-//		}
-//	}
-
-func main() {
-	scanner := bufio.NewScanner(os.Stdin)
-	node, _ := NewNode(NODE_COUNT)
-	for scanner.Scan() {
-		line := scanner.Text()
-		msg := Request{}
-		err := json.Unmarshal([]byte(line), &msg)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-			continue
-		}
-		fmt.Fprintf(os.Stderr, "Received \"%v\\n\"\n", msg)
-
-		body := msg.Body.(map[string]any)
-		bodyType := body["type"].(string)
-		node.handle(bodyType, msg)
+// envOr returns the value of the environment variable key, or def if it is
+// not set.
+func envOr(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
 	}
+	return def
 }
@@ -1,10 +1,11 @@
 module github.com/TropicalDog17/distributed/dis-sys-chall/go/grow-counter
 
-go 1.18
+go 1.21.1
 
 require (
+	github.com/jepsen-io/maelstrom/demo/go v0.0.0
+	github.com/project3/crdt v0.0.0
 	github.com/stretchr/testify v1.8.4
-	golang.org/x/exp v0.0.0-20230905200255-921286631fa9
 )
 
 require (
@@ -12,3 +13,8 @@ require (
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace (
+	github.com/jepsen-io/maelstrom/demo/go => ../maelstrom/demo/go
+	github.com/project3/crdt => ../crdt
+)
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// kvTimeout bounds every request to the key/value service.
+const kvTimeout = time.Second
+
+// kvRetryPolicy retries the idempotent requests to the key/value service
+// within kvTimeout.
+var kvRetryPolicy = maelstrom.RetryPolicy{
+	MaxAttempts:    3,
+	Backoff:        20 * time.Millisecond,
+	MaxBackoff:     100 * time.Millisecond,
+	AttemptTimeout: 250 * time.Millisecond,
+}
+
+// kvCASPolicy retries the swaps of an increment on definite errors only,
+// which guarantee that the swap was not applied.
+var kvCASPolicy = maelstrom.RetryPolicy{
+	MaxAttempts:    kvRetryPolicy.MaxAttempts,
+	Backoff:        kvRetryPolicy.Backoff,
+	MaxBackoff:     kvRetryPolicy.MaxBackoff,
+	AttemptTimeout: kvRetryPolicy.AttemptTimeout,
+	Retryable:      maelstrom.RetryDefinite,
+}
+
+// KVNode is a G-Counter stored in Maelstrom's seq-kv service rather than
+// replicated between nodes. Every node keeps its own entry of the counter
+// under a key of its own, so entries are only ever updated by their owner,
+// and reading the counter sums the entries of every node.
+type KVNode struct {
+	// retryKV retries failed requests. Reads and writes of the sync key are
+	// safe to retry, but an increment is not: a swap that timed out may have
+	// been applied, and applying it again would count the delta twice. casKV
+	// therefore only retries swaps that definitely failed.
+	retryKV *maelstrom.KV
+	casKV   *maelstrom.KV
+
+	n *maelstrom.Node
+}
+
+// NewKVNode returns a new seq-kv backed G-Counter node with its handlers
+// registered on n.
+func NewKVNode(n *maelstrom.Node) *KVNode {
+	kv := maelstrom.NewSeqKV(n)
+	node := &KVNode{
+		retryKV: kv.WithRetry(kvRetryPolicy),
+		casKV:   kv.WithRetry(kvCASPolicy),
+		n:       n,
+	}
+	maelstrom.HandleTyped(n, "add", node.handleAdd)
+	n.Handle("read", node.handleRead)
+	return node
+}
+
+// counterKey returns the key holding the entry of nodeID.
+func counterKey(nodeID string) string {
+	return "counter-" + nodeID
+}
+
+// syncKey returns the key nodeID writes to before reading the counter.
+func syncKey(nodeID string) string {
+	return "sync-" + nodeID
+}
+
+func (node *KVNode) handleAdd(msg maelstrom.Message, body addMessageBody) (maelstrom.MessageBody, error) {
+	if body.Delta < 0 {
+		return maelstrom.MessageBody{}, maelstrom.NewRPCError(maelstrom.MalformedRequest, "delta must not be negative")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kvTimeout)
+	defer cancel()
+	if err := node.increment(ctx, body.Delta); err != nil {
+		return maelstrom.MessageBody{}, err
+	}
+	return maelstrom.MessageBody{Type: "add_ok"}, nil
+}
+
+// increment adds delta to the node's entry. Concurrent adds on the same node
+// race on the entry, so the entry is swapped in a loop until it was not
+// changed between reading and swapping it.
+func (node *KVNode) increment(ctx context.Context, delta int) error {
+	key := counterKey(node.n.ID())
+	for {
+		// The node reads its own writes, so the entry is never stale.
+		count, err := node.readEntry(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		err = node.casKV.CompareAndSwap(ctx, key, count, count+delta, true)
+		if maelstrom.ErrorCode(err) != maelstrom.PreconditionFailed {
+			return err
+		}
+	}
+}
+
+func (node *KVNode) handleRead(msg maelstrom.Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), kvTimeout)
+	defer cancel()
+
+	// seq-kv may serve stale reads, but never older than the node's own last
+	// write. Writing a key first moves the node to the latest state, so the
+	// reads below see every add acknowledged before this read started.
+	if err := node.retryKV.Write(ctx, syncKey(node.n.ID()), time.Now().UnixNano()); err != nil {
+		return err
+	}
+
+	var sum int
+	for _, id := range node.n.NodeIDs() {
+		count, err := node.readEntry(ctx, counterKey(id))
+		if err != nil {
+			return err
+		}
+		sum += count
+	}
+
+	return node.n.Reply(msg, readOKMessageBody{
+		MessageBody: maelstrom.MessageBody{Type: "read_ok"},
+		Value:       sum,
+	})
+}
+
+// readEntry returns the counter entry stored under key. Entries that have not
+// been written yet are zero.
+func (node *KVNode) readEntry(ctx context.Context, key string) (int, error) {
+	count, err := node.retryKV.ReadInt(ctx, key)
+	if maelstrom.ErrorCode(err) == maelstrom.KeyDoesNotExist {
+		return 0, nil
+	}
+	return count, err
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TropicalDog17/distributed/dis-sys-chall/go/grow-counter/ds"
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+	"github.com/jepsen-io/maelstrom/demo/go/simnet"
+	"github.com/stretchr/testify/assert"
+)
+
+// startKVCluster runs a KVNode on every node in ids against a seq-kv stand-in
+// over a simulated network, and returns a client of the cluster.
+func startKVCluster(t *testing.T, ids ...string) (context.Context, *maelstrom.Node) {
+	t.Helper()
+	net := simnet.New(simnet.Config{Seed: 1, MaxLatency: time.Millisecond})
+	if _, err := ds.New(net.Service(maelstrom.SeqKV), maelstrom.SeqKV, rand.New(rand.NewSource(1))); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		NewKVNode(net.Node(id))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	if err := net.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { net.Close() })
+	return ctx, net.Client("c1")
+}
+
+// add sends an "add" request for delta to node.
+func add(ctx context.Context, client *maelstrom.Node, node string, delta int) error {
+	_, err := client.SyncRPC(ctx, node, addMessageBody{
+		MessageBody: maelstrom.MessageBody{Type: "add"},
+		Delta:       delta,
+	})
+	return err
+}
+
+// read returns the value of the counter read from node.
+func read(t *testing.T, ctx context.Context, client *maelstrom.Node, node string) int {
+	t.Helper()
+	resp, err := client.SyncRPC(ctx, node, maelstrom.MessageBody{Type: "read"})
+	if !assert.NoError(t, err) {
+		return 0
+	}
+	var body struct {
+		Value int `json:"value"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body, &body))
+	return body.Value
+}
+
+func TestKVNode_Read_Empty(t *testing.T) {
+	ctx, client := startKVCluster(t, "n1", "n2")
+	assert.Equal(t, 0, read(t, ctx, client, "n1"), "entries that were never written should count as zero")
+}
+
+// Ensure concurrent adds on every node are all counted, and that every node
+// reads them all once they are acknowledged even though seq-kv may serve
+// stale reads.
+func TestKVNode_Add_Concurrent(t *testing.T) {
+	ids := []string{"n1", "n2", "n3"}
+	ctx, client := startKVCluster(t, ids...)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var sum int
+	for i := 0; i < 30; i++ {
+		node, delta := ids[i%len(ids)], i%7+1
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := add(ctx, client, node, delta); err != nil {
+				t.Errorf("add %d on %s: %v", delta, node, err)
+				return
+			}
+			mu.Lock()
+			sum += delta
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		assert.Equal(t, sum, read(t, ctx, client, id), "read on %s", id)
+	}
+}
+
+func TestKVNode_Add_Negative(t *testing.T) {
+	ctx, client := startKVCluster(t, "n1")
+	err := add(ctx, client, "n1", -1)
+	assert.Equal(t, maelstrom.MalformedRequest, maelstrom.ErrorCode(err))
+	assert.Equal(t, 0, read(t, ctx, client, "n1"))
+}
+
+// Ensure a swap that definitely failed is retried, and that the delta is only
+// counted once.
+func TestKVNode_Add_RetryDefinite(t *testing.T) {
+	net := simnet.New(simnet.Config{})
+	kv := net.Service(maelstrom.SeqKV)
+
+	// The stand-in is unavailable for the first swap.
+	var (
+		mu     sync.Mutex
+		values = make(map[string]int)
+		swaps  int
+	)
+	kv.Handle("read", func(msg maelstrom.Message) error {
+		var body struct {
+			Key string `json:"key"`
+		}
+		if err := json.Unmarshal(msg.Body, &body); err != nil {
+			return err
+		}
+		if body.Key != counterKey("n1") {
+			t.Errorf("read %s, want only the entry of n1, the only cluster node", body.Key)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		value, ok := values[body.Key]
+		if !ok {
+			return maelstrom.NewRPCError(maelstrom.KeyDoesNotExist, "not found")
+		}
+		return kv.Reply(msg, map[string]any{"type": "read_ok", "value": value})
+	})
+	kv.Handle("write", func(msg maelstrom.Message) error {
+		return kv.Reply(msg, maelstrom.MessageBody{Type: "write_ok"})
+	})
+	kv.Handle("cas", func(msg maelstrom.Message) error {
+		var body struct {
+			Key string `json:"key"`
+			To  int    `json:"to"`
+		}
+		if err := json.Unmarshal(msg.Body, &body); err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if swaps++; swaps == 1 {
+			return maelstrom.NewRPCError(maelstrom.TemporarilyUnavailable, "busy")
+		}
+		values[body.Key] = body.To
+		return kv.Reply(msg, maelstrom.MessageBody{Type: "cas_ok"})
+	})
+	NewKVNode(net.Node("n1"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := net.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer net.Close()
+
+	client := net.Client("c1")
+	assert.NoError(t, add(ctx, client, "n1", 5))
+	assert.Equal(t, 5, read(t, ctx, client, "n1"))
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, swaps)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+	"github.com/project3/crdt"
+)
+
+// digestMessageBody represents the body for the "digest" message, which asks
+// for the Merkle hashes of the nodes at the given indices of a level.
+type digestMessageBody struct {
+	maelstrom.MessageBody
+	Level   int   `json:"level"`
+	Indices []int `json:"indices"`
+}
+
+// digestOKMessageBody represents the response body for the "digest_ok" message.
+type digestOKMessageBody struct {
+	maelstrom.MessageBody
+	Hashes []crdt.Hash `json:"hashes"`
+}
+
+// leavesMessageBody represents the body for the "leaves" message, which
+// carries the sender's elements in the given Merkle leaves.
+type leavesMessageBody struct {
+	maelstrom.MessageBody
+	Indices  []int          `json:"indices"`
+	Elements []crdt.Element `json:"elements"`
+}
+
+// leavesOKMessageBody represents the response body for the "leaves_ok"
+// message, which carries the receiver's elements in the requested leaves.
+type leavesOKMessageBody struct {
+	maelstrom.MessageBody
+	Elements []crdt.Element `json:"elements"`
+}
+
+// digest returns a Merkle tree over the local set. The set caches the tree
+// until it changes, so every level of a sync is answered from the same tree
+// without rehashing the set.
+func (node *Node) digest() *crdt.Digest {
+	var d *crdt.Digest
+	node.set.Read(func(s *crdt.GSet) { d = s.Digest() })
+	return d
+}
+
+// mergeElements adds elements received from a peer to the local set.
+func (node *Node) mergeElements(elements []crdt.Element) error {
+	other := crdt.NewGSet()
+	for _, element := range elements {
+		other.Add(element)
+	}
+	return node.set.Merge(other)
+}
+
+// sync reconciles the local set with peer by comparing Merkle digests from
+// the root down and exchanging only the elements of the leaves that differ.
+// When both sets are equal this costs a single round trip of one hash.
+func (node *Node) sync(ctx context.Context, peer string) error {
+	digest := node.digest()
+
+	indices := []int{0}
+	for level := 0; ; level++ {
+		resp, err := node.n.SyncRPC(ctx, peer, digestMessageBody{
+			MessageBody: maelstrom.MessageBody{Type: "digest"},
+			Level:       level,
+			Indices:     indices,
+		})
+		if err != nil {
+			return err
+		}
+		var body digestOKMessageBody
+		if err := json.Unmarshal(resp.Body, &body); err != nil {
+			return err
+		}
+
+		if indices, err = digest.Diff(level, indices, body.Hashes); err != nil {
+			return err
+		} else if len(indices) == 0 {
+			return nil // in sync
+		} else if level == digest.Depth() {
+			break // indices are the differing leaves
+		}
+		indices = digest.Children(indices)
+	}
+
+	// Push our elements in the differing leaves and pull theirs.
+	resp, err := node.n.SyncRPC(ctx, peer, leavesMessageBody{
+		MessageBody: maelstrom.MessageBody{Type: "leaves"},
+		Indices:     indices,
+		Elements:    digest.Elements(indices),
+	})
+	if err != nil {
+		return err
+	}
+	var body leavesOKMessageBody
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		return err
+	}
+	return node.mergeElements(body.Elements)
+}
+
+func (node *Node) handleDigest(msg maelstrom.Message, body digestMessageBody) (digestOKMessageBody, error) {
+	hashes, err := node.digest().Hashes(body.Level, body.Indices)
+	if err != nil {
+		return digestOKMessageBody{}, maelstrom.NewRPCError(maelstrom.MalformedRequest, err.Error())
+	}
+	return digestOKMessageBody{
+		MessageBody: maelstrom.MessageBody{Type: "digest_ok"},
+		Hashes:      hashes,
+	}, nil
+}
+
+func (node *Node) handleLeaves(msg maelstrom.Message, body leavesMessageBody) (leavesOKMessageBody, error) {
+	// Reply with the elements we had before merging the sender's.
+	elements := node.digest().Elements(body.Indices)
+	if err := node.mergeElements(body.Elements); err != nil {
+		return leavesOKMessageBody{}, err
+	}
+	return leavesOKMessageBody{
+		MessageBody: maelstrom.MessageBody{Type: "leaves_ok"},
+		Elements:    elements,
+	}, nil
+}
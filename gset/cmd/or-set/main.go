@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+	"github.com/project3/crdt"
+	"github.com/project3/crdt/replica"
+)
+
+// elementMessageBody represents the body for the "add" and "remove" messages.
+type elementMessageBody struct {
+	maelstrom.MessageBody
+	Element float64 `json:"element"`
+}
+
+// readOKMessageBody represents the response body for the "read_ok" message.
+type readOKMessageBody struct {
+	maelstrom.MessageBody
+	Value any `json:"value"`
+}
+
+// Node is an OR-Set replica running on top of a maelstrom.Node.
+type Node struct {
+	set *replica.Replica[*crdt.ORSet]
+
+	n *maelstrom.Node
+}
+
+// NewNode returns a new OR-Set node with its handlers registered on n. Changes
+// are replicated according to config.
+func NewNode(n *maelstrom.Node, config replica.Config) (*Node, error) {
+	node := &Node{
+		set: replica.New(n, crdt.NewORSet),
+		n:   n,
+	}
+	if err := node.set.Configure(config); err != nil {
+		return nil, err
+	}
+	maelstrom.HandleTyped(n, "add", node.handleAdd)
+	maelstrom.HandleTyped(n, "remove", node.handleRemove)
+	n.Handle("read", node.handleRead)
+	return node, nil
+}
+
+func (node *Node) handleAdd(msg maelstrom.Message, body elementMessageBody) (maelstrom.MessageBody, error) {
+	if err := node.set.Update(func(s *crdt.ORSet) (crdt.StateCRDT, error) {
+		return s.Add(node.n.ID(), body.Element), nil
+	}); err != nil {
+		return maelstrom.MessageBody{}, err
+	}
+	return maelstrom.MessageBody{Type: "add_ok"}, nil
+}
+
+// handleRemove removes the element from the local replica. Removing an
+// element that has not been observed locally is a no-op.
+func (node *Node) handleRemove(msg maelstrom.Message, body elementMessageBody) (maelstrom.MessageBody, error) {
+	if err := node.set.Update(func(s *crdt.ORSet) (crdt.StateCRDT, error) {
+		delta, _ := s.Remove(body.Element)
+		return delta, nil
+	}); err != nil {
+		return maelstrom.MessageBody{}, err
+	}
+	return maelstrom.MessageBody{Type: "remove_ok"}, nil
+}
+
+func (node *Node) handleRead(msg maelstrom.Message) error {
+	return node.n.Reply(msg, readOKMessageBody{
+		MessageBody: maelstrom.MessageBody{Type: "read_ok"},
+		Value:       node.set.Value(),
+	})
+}
+
+func main() {
+	config := replica.DefaultConfig()
+	if err := config.RegisterFlags(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+	flag.Parse()
+
+	n := maelstrom.NewNode()
+	node, err := NewNode(n, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Execute the node's message loop. This will run until STDIN is closed.
+	if err := n.Run(); err != nil {
+		log.Printf("ERROR: %s", err)
+		os.Exit(1)
+	}
+	if err := node.set.Close(); err != nil {
+		log.Printf("ERROR: %s", err)
+		os.Exit(1)
+	}
+}
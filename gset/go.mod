@@ -2,4 +2,12 @@ module github.com/project3/gset
 
 go 1.21.1
 
-require golang.org/x/exp v0.0.0-20231006140011-7918f672742d
+require (
+	github.com/jepsen-io/maelstrom/demo/go v0.0.0
+	github.com/project3/crdt v0.0.0
+)
+
+replace (
+	github.com/jepsen-io/maelstrom/demo/go => ../maelstrom/demo/go
+	github.com/project3/crdt => ../crdt
+)
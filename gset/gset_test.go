@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+	"github.com/project3/crdt"
+	"github.com/project3/crdt/replica"
+)
+
+// newTestNode returns a G-Set node for n1 in a cluster of three.
+func newTestNode(tb testing.TB) *Node {
+	tb.Helper()
+	n := maelstrom.NewNode()
+	n.Init("n1", []string{"n1", "n2", "n3"})
+	node, err := NewNode(n, replica.DefaultConfig())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return node
+}
+
+// disjointSets returns two sets of n elements each, with no element in common.
+func disjointSets(n int) (local, remote *crdt.GSet) {
+	local, remote = crdt.NewGSet(), crdt.NewGSet()
+	for i := 0; i < n; i++ {
+		local.Add(crdt.MustElement(i))
+		remote.Add(crdt.MustElement(n + i))
+	}
+	return local, remote
+}
+
+// mergeSets merges local and remote into the set of a new node, as received
+// in two "replicate" messages, and returns how long the merges took.
+func mergeSets(tb testing.TB, local, remote *crdt.GSet) time.Duration {
+	tb.Helper()
+	node := newTestNode(tb)
+	start := time.Now()
+	if err := node.set.Merge(local); err != nil {
+		tb.Fatal(err)
+	}
+	if err := node.set.Merge(remote); err != nil {
+		tb.Fatal(err)
+	}
+	return time.Since(start)
+}
+
+// BenchmarkNode_Merge merges two disjoint sets of n elements into the set of
+// a new node. The reported time per element stays roughly constant as n
+// grows, apart from cache effects.
+func BenchmarkNode_Merge(b *testing.B) {
+	for _, n := range []int{1_000, 10_000, 100_000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			local, remote := disjointSets(n)
+			b.ResetTimer()
+
+			var elapsed time.Duration
+			for i := 0; i < b.N; i++ {
+				elapsed += mergeSets(b, local, remote)
+			}
+			b.ReportMetric(float64(elapsed.Nanoseconds())/float64(b.N*2*n), "ns/element")
+		})
+	}
+}
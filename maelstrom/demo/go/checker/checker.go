@@ -0,0 +1,256 @@
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Checker checks a history.
+type Checker interface {
+	// Name returns the name of the checker, used in reports.
+	Name() string
+
+	// Check returns the result of checking the events of a history.
+	Check(events []Event) Result
+}
+
+// Result is the outcome of a checker.
+type Result struct {
+	Name     string
+	Valid    bool
+	Problems []string // why the history is invalid
+}
+
+// Report is the outcome of every checker run on a history.
+type Report struct {
+	Results []Result
+}
+
+// Check runs every checker on the events recorded by h.
+func Check(h *History, checkers ...Checker) Report {
+	events := h.Events()
+	var report Report
+	for _, c := range checkers {
+		result := c.Check(events)
+		result.Name = c.Name()
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+// Valid reports whether every checker passed.
+func (r Report) Valid() bool {
+	for _, result := range r.Results {
+		if !result.Valid {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns a line per checker stating whether it passed, followed by
+// the problems it found.
+func (r Report) String() string {
+	var b strings.Builder
+	for _, result := range r.Results {
+		status := "PASS"
+		if !result.Valid {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "%s %s\n", status, result.Name)
+		for _, problem := range result.Problems {
+			fmt.Fprintf(&b, "    %s\n", problem)
+		}
+	}
+	return b.String()
+}
+
+// invalid returns a failed result with the given problems.
+func invalid(problems ...string) Result {
+	return Result{Problems: problems}
+}
+
+// GSet returns a checker for grow-only sets: every element whose "add" was
+// acknowledged must be present in every final read, and reads must not
+// return elements that were never added. Final reads are the successful
+// reads invoked after every add completed.
+func GSet() Checker { return gsetChecker{} }
+
+type gsetChecker struct{}
+
+func (gsetChecker) Name() string { return "g-set" }
+
+func (gsetChecker) Check(events []Event) Result {
+	ops, err := operations(events)
+	if err != nil {
+		return invalid(err.Error())
+	}
+
+	acked := make(map[string]bool)     // elements whose add succeeded
+	attempted := make(map[string]bool) // elements whose add may have succeeded
+	for _, op := range ops {
+		if op.F == "add" {
+			attempted[encode(op.Input)] = true
+			if op.Type == OK {
+				acked[encode(op.Input)] = true
+			}
+		}
+	}
+
+	var problems []string
+	reads := finalReads(ops, "add")
+	if len(reads) == 0 {
+		return invalid("no final read")
+	}
+	for _, op := range ops {
+		if op.F != "read" || op.Type != OK {
+			continue
+		}
+		elements, ok := list(op.Output)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("read at %d returned %v, not a list", op.Return, op.Output))
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, e := range elements {
+			seen[encode(e)] = true
+			if !attempted[encode(e)] {
+				problems = append(problems, fmt.Sprintf("read at %d returned %s, which was never added", op.Return, encode(e)))
+			}
+		}
+		if !reads[op.Call] {
+			continue
+		}
+		if lost := missing(acked, seen); len(lost) > 0 {
+			problems = append(problems, fmt.Sprintf("final read at %d lost %s", op.Return, strings.Join(lost, ", ")))
+		}
+	}
+	return Result{Valid: len(problems) == 0, Problems: problems}
+}
+
+// missing returns the elements of want that are not in got, sorted.
+func missing(want, got map[string]bool) []string {
+	var elements []string
+	for e := range want {
+		if !got[e] {
+			elements = append(elements, e)
+		}
+	}
+	sort.Strings(elements)
+	return elements
+}
+
+// GCounter returns a checker for grow-only counters: every final read must
+// return the sum of the acknowledged "add" deltas, plus any of the deltas
+// whose outcome is unknown. Final reads are the successful reads invoked
+// after every add completed.
+func GCounter() Checker { return gcounterChecker{} }
+
+type gcounterChecker struct{}
+
+func (gcounterChecker) Name() string { return "g-counter" }
+
+func (gcounterChecker) Check(events []Event) Result {
+	ops, err := operations(events)
+	if err != nil {
+		return invalid(err.Error())
+	}
+
+	// The final value lies between the sum of the acknowledged deltas and that
+	// sum plus every delta that may have been applied.
+	var lower, upper float64
+	for _, op := range ops {
+		if op.F != "add" {
+			continue
+		}
+		delta, ok := number(op.Input)
+		if !ok {
+			return invalid(fmt.Sprintf("add at %d has delta %v, not a number", op.Call, op.Input))
+		}
+		switch {
+		case op.Type == OK:
+			lower += delta
+			upper += delta
+		case delta < 0:
+			lower += delta
+		default:
+			upper += delta
+		}
+	}
+
+	reads := finalReads(ops, "add")
+	if len(reads) == 0 {
+		return invalid("no final read")
+	}
+	var problems []string
+	for _, op := range ops {
+		if !reads[op.Call] {
+			continue
+		}
+		value, ok := number(op.Output)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("final read at %d returned %v, not a number", op.Return, op.Output))
+		} else if value < lower || value > upper {
+			problems = append(problems, fmt.Sprintf("final read at %d returned %v, want %s", op.Return, value, bounds(lower, upper)))
+		}
+	}
+	return Result{Valid: len(problems) == 0, Problems: problems}
+}
+
+// bounds describes the range of acceptable values [lower, upper].
+func bounds(lower, upper float64) string {
+	if lower == upper {
+		return fmt.Sprint(lower)
+	}
+	return fmt.Sprintf("between %v and %v", lower, upper)
+}
+
+// finalReads returns the invocation indexes of the successful reads invoked
+// after every operation f completed. Operations with an unknown outcome never
+// complete, so they do not hold back the final reads.
+func finalReads(ops []Operation, f string) map[int]bool {
+	last := -1
+	for _, op := range ops {
+		if op.F == f && op.Type == OK && op.Return > last {
+			last = op.Return
+		}
+	}
+
+	reads := make(map[int]bool)
+	for _, op := range ops {
+		if op.F == "read" && op.Type == OK && op.Call > last {
+			reads[op.Call] = true
+		}
+	}
+	return reads
+}
+
+// number returns v as a float64 if it is a number.
+func number(v any) (float64, bool) {
+	var f float64
+	if v == nil || json.Unmarshal([]byte(encode(v)), &f) != nil {
+		return 0, false
+	}
+	return f, true
+}
+
+// list returns v as a list of values decoded from JSON if it is a list.
+func list(v any) ([]any, bool) {
+	var l []any
+	if v == nil || json.Unmarshal([]byte(encode(v)), &l) != nil {
+		return nil, false
+	}
+	return l, true
+}
+
+// encode returns the JSON encoding of v, so that values decoded from JSON and
+// values built in Go compare equal if they encode the same value.
+func encode(v any) string {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(buf)
+}
@@ -0,0 +1,150 @@
+package checker_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+	"github.com/jepsen-io/maelstrom/demo/go/checker"
+)
+
+func TestHistory_Record(t *testing.T) {
+	h := checker.NewHistory()
+	h.Record("c1", "add", 1, func() (any, error) { return nil, nil })
+	h.Record("c1", "add", 2, func() (any, error) {
+		return nil, maelstrom.NewRPCError(maelstrom.TemporarilyUnavailable, "busy")
+	})
+	h.Record("c1", "add", 3, func() (any, error) {
+		return nil, maelstrom.NewRPCError(maelstrom.Crash, "boom")
+	})
+	h.Record("c1", "add", 4, func() (any, error) { return nil, context.DeadlineExceeded })
+	h.Record("c1", "read", []any{"x", nil}, func() (any, error) {
+		return nil, maelstrom.NewRPCError(maelstrom.KeyDoesNotExist, "not found")
+	})
+
+	var types []checker.Type
+	for _, e := range h.Events() {
+		types = append(types, e.Type)
+	}
+	want := []checker.Type{
+		checker.Invoke, checker.OK,
+		checker.Invoke, checker.Fail,
+		checker.Invoke, checker.Info,
+		checker.Invoke, checker.Info,
+		checker.Invoke, checker.OK,
+	}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("types=%v, want %v", types, want)
+	}
+
+	// A read of a missing key is recorded as reading nothing.
+	events := h.Events()
+	if got, want := events[len(events)-1].Value, []any{"x", nil}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("read value=%v, want %v", got, want)
+	}
+}
+
+func TestGSet(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		h := checker.NewHistory()
+		op(h, "c1", "add", 1, checker.OK, nil)
+		op(h, "c2", "add", 2, checker.Info, nil) // may or may not be present
+		op(h, "c1", "read", nil, checker.OK, []any{1.0, 2.0})
+		op(h, "c2", "read", nil, checker.OK, []int{1})
+		assertValid(t, checker.Check(h, checker.GSet()))
+	})
+
+	t.Run("Lost", func(t *testing.T) {
+		h := checker.NewHistory()
+		op(h, "c1", "add", 1, checker.OK, nil)
+		op(h, "c1", "add", 2, checker.OK, nil)
+		op(h, "c1", "read", nil, checker.OK, []any{1})
+		assertInvalid(t, checker.Check(h, checker.GSet()), "final read at 5 lost 2")
+	})
+
+	t.Run("NeverAdded", func(t *testing.T) {
+		h := checker.NewHistory()
+		op(h, "c1", "add", 1, checker.OK, nil)
+		op(h, "c1", "read", nil, checker.OK, []any{1, 3})
+		assertInvalid(t, checker.Check(h, checker.GSet()), "read at 3 returned 3, which was never added")
+	})
+
+	t.Run("NoFinalRead", func(t *testing.T) {
+		h := checker.NewHistory()
+		h.Invoke("c1", "read", nil)
+		op(h, "c2", "add", 1, checker.OK, nil)
+		h.OK("c1", "read", []any{})
+		assertInvalid(t, checker.Check(h, checker.GSet()), "no final read")
+	})
+}
+
+func TestGCounter(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		h := checker.NewHistory()
+		op(h, "c1", "add", 2, checker.OK, nil)
+		op(h, "c2", "add", 3, checker.OK, nil)
+		op(h, "c2", "add", 4, checker.Fail, nil)
+		op(h, "c1", "read", nil, checker.OK, 5)
+		assertValid(t, checker.Check(h, checker.GCounter()))
+	})
+
+	t.Run("Wrong", func(t *testing.T) {
+		h := checker.NewHistory()
+		op(h, "c1", "add", 2, checker.OK, nil)
+		op(h, "c1", "read", nil, checker.OK, 3)
+		assertInvalid(t, checker.Check(h, checker.GCounter()), "final read at 3 returned 3, want 2")
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		h := checker.NewHistory()
+		op(h, "c1", "add", 2, checker.OK, nil)
+		op(h, "c2", "add", 3, checker.Info, nil)
+		op(h, "c3", "read", nil, checker.OK, 5)
+		op(h, "c4", "read", nil, checker.OK, 2)
+		op(h, "c5", "read", nil, checker.OK, 6)
+		assertInvalid(t, checker.Check(h, checker.GCounter()), "final read at 9 returned 6, want between 2 and 5")
+	})
+}
+
+func TestReport_String(t *testing.T) {
+	h := checker.NewHistory()
+	op(h, "c1", "add", 2, checker.OK, nil)
+	op(h, "c1", "read", nil, checker.OK, 2)
+	report := checker.Check(h, checker.GCounter(), checker.GSet())
+	if got, want := report.String(), "PASS g-counter\nFAIL g-set\n    read at 3 returned 2, not a list\n"; got != want {
+		t.Fatalf("report=%q, want %q", got, want)
+	}
+}
+
+// op records an operation of process that completes with typ and output.
+func op(h *checker.History, process, f string, input any, typ checker.Type, output any) {
+	h.Invoke(process, f, input)
+	switch typ {
+	case checker.OK:
+		h.OK(process, f, output)
+	case checker.Fail:
+		h.Fail(process, f, input, errors.New("failed"))
+	case checker.Info:
+		h.Info(process, f, input, errors.New("timed out"))
+	}
+}
+
+func assertValid(tb testing.TB, report checker.Report) {
+	tb.Helper()
+	if !report.Valid() {
+		tb.Fatalf("unexpected failure:\n%s", report)
+	}
+}
+
+func assertInvalid(tb testing.TB, report checker.Report, problem string) {
+	tb.Helper()
+	if report.Valid() {
+		tb.Fatalf("unexpected success:\n%s", report)
+	}
+	if !strings.Contains(report.String(), problem) {
+		tb.Fatalf("report does not mention %q:\n%s", problem, report)
+	}
+}
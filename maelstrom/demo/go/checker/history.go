@@ -0,0 +1,205 @@
+// Package checker records histories of client operations against a cluster
+// and checks them, in the style of Jepsen, so that local runs can be
+// validated without Maelstrom.
+//
+// A history is a sequence of events. Each operation is an "invoke" event
+// followed by a completion by the same process: "ok" if the operation took
+// place, "fail" if it definitely did not, or "info" if its outcome is
+// unknown, e.g. because the request timed out. A process performs one
+// operation at a time.
+//
+// Operation values follow the conventions of Maelstrom's workloads:
+//
+//   - G-Set: "add" with the element, and "read" completing with the list of
+//     elements.
+//   - G-Counter: "add" with the delta, and "read" completing with the value.
+//   - Key/value: "read" with [key, nil] completing with [key, value], or
+//     [key, nil] if the key does not exist, "write" with [key, value], and
+//     "cas" with [key, [from, to]].
+package checker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// Type is the type of an event.
+type Type string
+
+// Event types.
+const (
+	Invoke Type = "invoke"
+	OK     Type = "ok"
+	Fail   Type = "fail"
+	Info   Type = "info"
+)
+
+// Event is a single entry of a history.
+type Event struct {
+	Index   int           `json:"index"`
+	Type    Type          `json:"type"`
+	Process string        `json:"process"`
+	F       string        `json:"f"`
+	Value   any           `json:"value"`
+	Time    time.Duration `json:"time"` // since the start of the history
+	Error   string        `json:"error,omitempty"`
+}
+
+// String returns a short description of the event.
+func (e Event) String() string {
+	s := fmt.Sprintf("%d %s %s %s %v", e.Index, e.Process, e.Type, e.F, e.Value)
+	if e.Error != "" {
+		s += " " + e.Error
+	}
+	return s
+}
+
+// History records events. It is safe for concurrent use.
+type History struct {
+	mu     sync.Mutex
+	start  time.Time
+	events []Event
+}
+
+// NewHistory returns an empty history starting now.
+func NewHistory() *History {
+	return &History{start: time.Now()}
+}
+
+// Invoke records that process invokes the operation f with value.
+func (h *History) Invoke(process, f string, value any) {
+	h.add(Event{Type: Invoke, Process: process, F: f, Value: value})
+}
+
+// OK records that the operation of process took place, with the result
+// value.
+func (h *History) OK(process, f string, value any) {
+	h.add(Event{Type: OK, Process: process, F: f, Value: value})
+}
+
+// Fail records that the operation of process definitely did not take place.
+func (h *History) Fail(process, f string, value any, err error) {
+	h.add(Event{Type: Fail, Process: process, F: f, Value: value, Error: errorText(err)})
+}
+
+// Info records that the outcome of the operation of process is unknown.
+func (h *History) Info(process, f string, value any, err error) {
+	h.add(Event{Type: Info, Process: process, F: f, Value: value, Error: errorText(err)})
+}
+
+// Record records the invocation of the operation f with value by process,
+// performs it by calling fn, and records its completion. An error returned by
+// fn is recorded as a failure if it is definite, see maelstrom.Definite, and
+// as an unknown outcome otherwise. Returns the result of fn.
+//
+// Like Maelstrom, a "read" that fails with KeyDoesNotExist is recorded as
+// reading no value, with the key/value result [key, nil], so that a stale
+// read of a missing key is checked like any other read.
+func (h *History) Record(process, f string, value any, fn func() (any, error)) (any, error) {
+	h.Invoke(process, f, value)
+	result, err := fn()
+	switch {
+	case err == nil:
+		h.OK(process, f, result)
+	case f == "read" && maelstrom.ErrorCode(err) == maelstrom.KeyDoesNotExist:
+		h.OK(process, f, missingRead(value))
+	case maelstrom.Definite(err):
+		h.Fail(process, f, value, err)
+	default:
+		h.Info(process, f, value, err)
+	}
+	return result, err
+}
+
+// Events returns a copy of the events recorded so far.
+func (h *History) Events() []Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Event(nil), h.events...)
+}
+
+func (h *History) add(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e.Index = len(h.events)
+	e.Time = time.Since(h.start)
+	h.events = append(h.events, e)
+}
+
+// missingRead returns the result of a read of a key that does not exist,
+// where value is the value of the read's invocation.
+func missingRead(value any) any {
+	if input, ok := list(value); ok && len(input) == 2 {
+		return []any{input[0], nil}
+	}
+	return nil
+}
+
+// errorText returns the text of err, or "" if err is nil.
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// Operation is an operation of a history: an invocation paired with its
+// completion.
+type Operation struct {
+	Process string
+	F       string
+	Input   any // value of the invocation
+	Output  any // value of the completion; nil if the outcome is unknown
+	Type    Type
+
+	Call   int // index of the invocation
+	Return int // index of the completion; len(events) if the outcome is unknown
+}
+
+// operations pairs the invocations of events with their completions.
+// Operations that failed are omitted. Operations that were never completed
+// have an unknown outcome.
+func operations(events []Event) ([]Operation, error) {
+	var ops []Operation
+	pending := make(map[string]int) // index in ops of each process's invocation
+	for _, e := range events {
+		if e.Type == Invoke {
+			if _, ok := pending[e.Process]; ok {
+				return nil, fmt.Errorf("event %d: process %s invoked %s while busy", e.Index, e.Process, e.F)
+			}
+			pending[e.Process] = len(ops)
+			ops = append(ops, Operation{
+				Process: e.Process,
+				F:       e.F,
+				Input:   e.Value,
+				Type:    Info,
+				Call:    e.Index,
+				Return:  len(events),
+			})
+			continue
+		}
+
+		i, ok := pending[e.Process]
+		if !ok {
+			return nil, fmt.Errorf("event %d: process %s completed %s without invoking it", e.Index, e.Process, e.F)
+		}
+		delete(pending, e.Process)
+		ops[i].Type = e.Type
+		if e.Type == OK {
+			ops[i].Output = e.Value
+			ops[i].Return = e.Index
+		}
+	}
+
+	// Drop the operations known not to have happened.
+	completed := ops[:0]
+	for _, op := range ops {
+		if op.Type != Fail {
+			completed = append(completed, op)
+		}
+	}
+	return completed, nil
+}
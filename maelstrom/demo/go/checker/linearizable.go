@@ -0,0 +1,265 @@
+package checker
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Model is the sequential specification of an object, against which a
+// history is checked for linearizability.
+type Model struct {
+	// Init returns the initial state of the object.
+	Init func() any
+
+	// Step returns the state after applying op to state, and whether op could
+	// have returned its output in state. The output of an operation whose
+	// outcome is unknown is nil. Step must not modify state.
+	Step func(state any, op Operation) (bool, any)
+
+	// Partition optionally splits a history into independent histories, such
+	// as the operations on each key, which are checked separately.
+	Partition func(ops []Operation) ([][]Operation, error)
+}
+
+// Linearizable returns a checker verifying that a history is linearizable
+// with respect to model: that every successful operation appears to take
+// effect atomically at some point between its invocation and its completion.
+// Operations whose outcome is unknown may or may not take effect. The search
+// explores the orders allowed by the history, pruning states it has already
+// seen, like Knossos and Porcupine, so it is exponential in the worst case
+// but fast for histories with little concurrency.
+func Linearizable(model Model) Checker { return linearizableChecker{model: model} }
+
+type linearizableChecker struct {
+	model Model
+}
+
+func (linearizableChecker) Name() string { return "linearizable" }
+
+func (c linearizableChecker) Check(events []Event) Result {
+	ops, err := operations(events)
+	if err != nil {
+		return invalid(err.Error())
+	}
+
+	partitions := [][]Operation{ops}
+	if c.model.Partition != nil {
+		if partitions, err = c.model.Partition(ops); err != nil {
+			return invalid(err.Error())
+		}
+	}
+
+	var problems []string
+	for _, ops := range partitions {
+		if problem := linearize(c.model, ops); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	return Result{Valid: len(problems) == 0, Problems: problems}
+}
+
+// linearize searches for a linearization of ops. Returns a description of the
+// operation that could not be linearized, or "" if ops are linearizable.
+func linearize(model Model, ops []Operation) string {
+	ops = append([]Operation(nil), ops...)
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Call < ops[j].Call })
+
+	s := &search{
+		model:   model,
+		ops:     ops,
+		done:    make([]bool, len(ops)),
+		seen:    make(map[string]bool),
+		stuck:   -1,
+		deepest: -1,
+	}
+	for _, op := range ops {
+		if op.Type == OK {
+			s.pending++
+		}
+	}
+	if s.step(model.Init(), 0) {
+		return ""
+	}
+
+	op := ops[s.stuck]
+	return fmt.Sprintf("cannot linearize %s %s %s -> %s (event %d) from state %v",
+		op.Process, op.F, encode(op.Input), encode(op.Output), op.Return, s.state)
+}
+
+// search is a depth-first search for a linearization.
+type search struct {
+	model   Model
+	ops     []Operation // sorted by invocation
+	done    []bool      // operations linearized so far
+	pending int         // successful operations not linearized yet
+	seen    map[string]bool
+
+	// The first successful operation left over by the deepest partial
+	// linearization, and the state it ended in, to report failures.
+	deepest int
+	stuck   int
+	state   any
+}
+
+// step extends the current partial linearization of depth operations in
+// state. Reports whether it can be completed.
+func (s *search) step(state any, depth int) bool {
+	if s.pending == 0 {
+		return true
+	}
+	key := s.key(state)
+	if s.seen[key] {
+		return false
+	}
+	s.seen[key] = true
+
+	// An operation can come next if it was invoked before every remaining
+	// operation completed.
+	bound := -1
+	for i, op := range s.ops {
+		if !s.done[i] && (bound < 0 || op.Return < bound) {
+			bound = op.Return
+		}
+	}
+
+	for i, op := range s.ops {
+		if op.Call > bound {
+			break
+		}
+		if s.done[i] {
+			continue
+		}
+		ok, next := s.model.Step(state, op)
+		if !ok {
+			continue
+		}
+
+		s.done[i] = true
+		if op.Type == OK {
+			s.pending--
+		}
+		found := s.step(next, depth+1)
+		s.done[i] = false
+		if op.Type == OK {
+			s.pending++
+		}
+		if found {
+			return true
+		}
+	}
+
+	if depth > s.deepest {
+		s.deepest, s.state = depth, state
+		for i, op := range s.ops {
+			if !s.done[i] && op.Type == OK {
+				s.stuck = i
+				break
+			}
+		}
+	}
+	return false
+}
+
+// key identifies the set of linearized operations and the state.
+func (s *search) key(state any) string {
+	bits := make([]byte, 0, len(s.done)/8+1+len(encode(state)))
+	var b byte
+	for i, done := range s.done {
+		if done {
+			b |= 1 << (i % 8)
+		}
+		if i%8 == 7 || i == len(s.done)-1 {
+			bits = append(bits, b)
+			b = 0
+		}
+	}
+	return string(bits) + encode(state) // the bitset has a fixed length
+}
+
+// KV returns the model of a linearizable key/value store such as lin-kv, for
+// "read", "write" and "cas" operations with values in the format of
+// Maelstrom's lin-kv workload. The state of each key is checked separately.
+// A read of a key that does not exist completes with [key, nil].
+func KV() Model {
+	return Model{
+		Init:      func() any { return kvValue("") },
+		Step:      kvStep,
+		Partition: kvPartition,
+	}
+}
+
+// kvValue is the encoded value of a key, or "" if the key does not exist.
+type kvValue string
+
+func (v kvValue) String() string {
+	if v == "" {
+		return "<none>"
+	}
+	return string(v)
+}
+
+// kvStep applies a key/value operation to the value of a key.
+func kvStep(state any, op Operation) (bool, any) {
+	value := state.(kvValue)
+	input, _ := list(op.Input)
+	switch op.F {
+	case "read":
+		if op.Output == nil {
+			return true, value // unknown reads have no effect
+		}
+		output, _ := list(op.Output)
+		if output[1] == nil {
+			return value == "", value // the key does not exist
+		}
+		return kvValue(encode(output[1])) == value, value
+	case "write":
+		return true, kvValue(encode(input[1]))
+	case "cas":
+		args, _ := list(input[1])
+		if kvValue(encode(args[0])) != value {
+			return false, value
+		}
+		return true, kvValue(encode(args[1]))
+	default:
+		return false, value
+	}
+}
+
+// kvPartition groups key/value operations by key.
+func kvPartition(ops []Operation) ([][]Operation, error) {
+	var keys []string
+	byKey := make(map[string][]Operation)
+	for _, op := range ops {
+		input, ok := list(op.Input)
+		if !ok || len(input) != 2 {
+			return nil, fmt.Errorf("event %d: %s of %s, want [key, value]", op.Call, op.F, encode(op.Input))
+		}
+		switch op.F {
+		case "read":
+			if op.Output != nil {
+				if output, ok := list(op.Output); !ok || len(output) != 2 {
+					return nil, fmt.Errorf("event %d: read returned %s, want [key, value]", op.Return, encode(op.Output))
+				}
+			}
+		case "write":
+		case "cas":
+			if args, ok := list(input[1]); !ok || len(args) != 2 {
+				return nil, fmt.Errorf("event %d: cas of %s, want [key, [from, to]]", op.Call, encode(op.Input))
+			}
+		default:
+			return nil, fmt.Errorf("event %d: unknown key/value operation %q", op.Call, op.F)
+		}
+
+		key := encode(input[0])
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], op)
+	}
+
+	partitions := make([][]Operation, 0, len(keys))
+	for _, key := range keys {
+		partitions = append(partitions, byKey[key])
+	}
+	return partitions, nil
+}
@@ -0,0 +1,167 @@
+package checker_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+	"github.com/jepsen-io/maelstrom/demo/go/checker"
+	"github.com/jepsen-io/maelstrom/demo/go/simnet"
+)
+
+func TestLinearizable_KV(t *testing.T) {
+	t.Run("Sequential", func(t *testing.T) {
+		h := checker.NewHistory()
+		op(h, "c1", "write", []any{"x", 1}, checker.OK, nil)
+		op(h, "c1", "cas", []any{"x", []any{1, 2}}, checker.OK, nil)
+		op(h, "c2", "read", []any{"x", nil}, checker.OK, []any{"x", 2})
+		op(h, "c2", "cas", []any{"x", []any{1, 3}}, checker.Fail, nil)
+		assertValid(t, checker.Check(h, checker.Linearizable(checker.KV())))
+	})
+
+	t.Run("StaleRead", func(t *testing.T) {
+		h := checker.NewHistory()
+		op(h, "c1", "write", []any{"x", 1}, checker.OK, nil)
+		op(h, "c1", "write", []any{"x", 2}, checker.OK, nil)
+		op(h, "c2", "read", []any{"x", nil}, checker.OK, []any{"x", 1})
+		assertInvalid(t, checker.Check(h, checker.Linearizable(checker.KV())),
+			`cannot linearize c2 read ["x",null] -> ["x",1] (event 5) from state 2`)
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		// The read overlaps both writes, so it may see either value.
+		h := checker.NewHistory()
+		h.Invoke("c3", "read", []any{"x", nil})
+		op(h, "c1", "write", []any{"x", 1}, checker.OK, nil)
+		op(h, "c2", "write", []any{"x", 2}, checker.OK, nil)
+		h.OK("c3", "read", []any{"x", 1})
+		assertValid(t, checker.Check(h, checker.Linearizable(checker.KV())))
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		// A write with an unknown outcome can take effect at any later time.
+		h := checker.NewHistory()
+		op(h, "c1", "write", []any{"x", 1}, checker.OK, nil)
+		op(h, "c2", "write", []any{"x", 2}, checker.Info, nil)
+		op(h, "c1", "read", []any{"x", nil}, checker.OK, []any{"x", 1})
+		op(h, "c1", "read", []any{"x", nil}, checker.OK, []any{"x", 2})
+		assertValid(t, checker.Check(h, checker.Linearizable(checker.KV())))
+
+		// But not before it was invoked.
+		h = checker.NewHistory()
+		op(h, "c1", "read", []any{"x", nil}, checker.OK, []any{"x", 2})
+		op(h, "c2", "write", []any{"x", 2}, checker.Info, nil)
+		assertInvalid(t, checker.Check(h, checker.Linearizable(checker.KV())), "from state <none>")
+	})
+
+	t.Run("MissingKey", func(t *testing.T) {
+		h := checker.NewHistory()
+		op(h, "c1", "read", []any{"x", nil}, checker.OK, []any{"x", nil})
+		op(h, "c1", "write", []any{"x", 1}, checker.OK, nil)
+		op(h, "c1", "read", []any{"x", nil}, checker.OK, []any{"x", 1})
+		assertValid(t, checker.Check(h, checker.Linearizable(checker.KV())))
+	})
+
+	t.Run("StaleMissingKey", func(t *testing.T) {
+		// The key was written before the read started, so it cannot be
+		// missing.
+		h := checker.NewHistory()
+		op(h, "c1", "write", []any{"x", 1}, checker.OK, nil)
+		h.Record("c2", "read", []any{"x", nil}, func() (any, error) {
+			return nil, maelstrom.NewRPCError(maelstrom.KeyDoesNotExist, "not found")
+		})
+		assertInvalid(t, checker.Check(h, checker.Linearizable(checker.KV())),
+			`cannot linearize c2 read ["x",null] -> ["x",null] (event 3) from state 1`)
+	})
+
+	t.Run("Keys", func(t *testing.T) {
+		h := checker.NewHistory()
+		op(h, "c1", "write", []any{"x", 1}, checker.OK, nil)
+		op(h, "c1", "write", []any{"y", 2}, checker.OK, nil)
+		op(h, "c1", "read", []any{"x", nil}, checker.OK, []any{"x", 1})
+		assertValid(t, checker.Check(h, checker.Linearizable(checker.KV())))
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		h := checker.NewHistory()
+		op(h, "c1", "cas", []any{"x", 1}, checker.OK, nil)
+		assertInvalid(t, checker.Check(h, checker.Linearizable(checker.KV())), "want [key, [from, to]]")
+	})
+}
+
+// Ensure a register served by a single node over a simulated network is
+// linearizable.
+func TestLinearizable_Simnet(t *testing.T) {
+	net := simnet.New(simnet.Config{Seed: 1, MaxLatency: time.Millisecond})
+	n := net.Node("n1")
+	var (
+		mu    sync.Mutex
+		value any
+	)
+	n.Handle("read", func(msg maelstrom.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if value == nil {
+			return maelstrom.NewRPCError(maelstrom.KeyDoesNotExist, "not found")
+		}
+		return n.Reply(msg, map[string]any{"type": "read_ok", "value": value})
+	})
+	n.Handle("write", func(msg maelstrom.Message) error {
+		var body struct {
+			Value any `json:"value"`
+		}
+		if err := json.Unmarshal(msg.Body, &body); err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		value = body.Value
+		return n.Reply(msg, maelstrom.MessageBody{Type: "write_ok"})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := net.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer net.Close()
+
+	h := checker.NewHistory()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		process := fmt.Sprintf("c%d", i)
+		client := net.Client(process)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if j%2 == 0 {
+					v := fmt.Sprintf("%s-%d", process, j)
+					h.Record(process, "write", []any{"x", v}, func() (any, error) {
+						_, err := client.SyncRPC(ctx, "n1", map[string]any{"type": "write", "value": v})
+						return nil, err
+					})
+					continue
+				}
+				h.Record(process, "read", []any{"x", nil}, func() (any, error) {
+					resp, err := client.SyncRPC(ctx, "n1", maelstrom.MessageBody{Type: "read"})
+					if err != nil {
+						return nil, err
+					}
+					var body struct {
+						Value any `json:"value"`
+					}
+					err = json.Unmarshal(resp.Body, &body)
+					return []any{"x", body.Value}, err
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	assertValid(t, checker.Check(h, checker.Linearizable(checker.KV())))
+}
@@ -14,8 +14,9 @@ const (
 
 // KV represents a client to the key/value store service.
 type KV struct {
-	typ  string
-	node *Node
+	typ   string
+	node  *Node
+	retry *RetryPolicy // nil if requests are not retried
 }
 
 // NewKV returns a new instance a KV client for a node.
@@ -35,10 +36,33 @@ func NewSeqKV(node *Node) *KV { return NewKV(SeqKV, node) }
 // NewLWWKV returns a client to the last-write-wins key/value store.
 func NewLWWKV(node *Node) *KV { return NewKV(LWWKV, node) }
 
+// WithRetry returns a client to the same store that retries failed requests
+// according to policy.
+//
+// Reads are always safe to retry, and writes are idempotent. A CompareAndSwap
+// that timed out may have taken effect, so its retry can fail with
+// PreconditionFailed even though the value was swapped: only retry
+// CompareAndSwap on indefinite errors if the caller can tell the two cases
+// apart, and otherwise use a policy retrying definite errors only, see
+// RetryDefinite.
+func (kv *KV) WithRetry(policy RetryPolicy) *KV {
+	other := *kv
+	other.retry = &policy
+	return &other
+}
+
+// rpc sends a request to the store, retrying it if the client has a policy.
+func (kv *KV) rpc(ctx context.Context, body any) (Message, error) {
+	if kv.retry == nil {
+		return kv.node.SyncRPC(ctx, kv.typ, body)
+	}
+	return kv.node.RetryRPC(ctx, kv.typ, body, *kv.retry)
+}
+
 // Read returns the value for a given key in the key/value store.
 // Returns an *RPCError error with a KeyDoesNotExist code if the key does not exist.
 func (kv *KV) Read(ctx context.Context, key string) (any, error) {
-	resp, err := kv.node.SyncRPC(ctx, kv.typ, kvReadMessageBody{
+	resp, err := kv.rpc(ctx, kvReadMessageBody{
 		MessageBody: MessageBody{Type: "read"},
 		Key:         key,
 	})
@@ -70,7 +94,7 @@ func (kv *KV) ReadInt(ctx context.Context, key string) (int, error) {
 
 // Write overwrites the value for a given key in the key/value store.
 func (kv *KV) Write(ctx context.Context, key string, value any) error {
-	_, err := kv.node.SyncRPC(ctx, kv.typ, kvWriteMessageBody{
+	_, err := kv.rpc(ctx, kvWriteMessageBody{
 		MessageBody: MessageBody{Type: "write"},
 		Key:         key,
 		Value:       value,
@@ -84,7 +108,7 @@ func (kv *KV) Write(ctx context.Context, key string, value any) error {
 // Returns an *RPCError with a code of PreconditionFailed if the previous value
 // does not match. Return a code of KeyDoesNotExist if the key did not exist.
 func (kv *KV) CompareAndSwap(ctx context.Context, key string, from, to any, createIfNotExists bool) error {
-	_, err := kv.node.SyncRPC(ctx, kv.typ, kvCASMessageBody{
+	_, err := kv.rpc(ctx, kvCASMessageBody{
 		MessageBody:       MessageBody{Type: "cas"},
 		Key:               key,
 		From:              from,
@@ -9,19 +9,31 @@ import (
 	"log"
 	"os"
 	"sync"
+	"time"
 )
 
+// maxMessageSize is the size of the longest message Run reads from STDIN.
+// Bodies such as the full state of a CRDT easily exceed the scanner's
+// default of 64KiB.
+const maxMessageSize = 1 << 24
+
 // Node represents a single node in the network.
 type Node struct {
-	mu sync.Mutex
-	wg sync.WaitGroup
+	mu    sync.Mutex
+	outMu sync.Mutex // serializes writes to Stdout
+	wg    sync.WaitGroup
+
+	// ctx is cancelled once Run stops reading messages.
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	id        string
 	nodeIDs   []string
 	nextMsgID int
 
 	handlers  map[string]HandlerFunc
-	callbacks map[int]HandlerFunc
+	fallback  HandlerFunc
+	callbacks map[int]*callback
 
 	// Stdin is for reading messages in from the Maelstrom network.
 	Stdin io.Reader
@@ -32,9 +44,13 @@ type Node struct {
 
 // NewNode returns a new instance of Node connected to STDIN/STDOUT.
 func NewNode() *Node {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Node{
+		ctx:    ctx,
+		cancel: cancel,
+
 		handlers:  make(map[string]HandlerFunc),
-		callbacks: make(map[int]HandlerFunc),
+		callbacks: make(map[int]*callback),
 
 		Stdin:  os.Stdin,
 		Stdout: os.Stdout,
@@ -45,6 +61,8 @@ func NewNode() *Node {
 // receiving an "init" message but it can also be called manually when
 // initializing unit tests.
 func (n *Node) Init(id string, nodeIDs []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
 	n.id = id
 	n.nodeIDs = nodeIDs
 }
@@ -52,6 +70,8 @@ func (n *Node) Init(id string, nodeIDs []string) {
 // ID returns the identifier for this node.
 // Only valid after "init" message has been received.
 func (n *Node) ID() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
 	return n.id
 }
 
@@ -59,6 +79,8 @@ func (n *Node) ID() string {
 // local node ID and is the same order across all nodes. Only valid after "init"
 // message has been received.
 func (n *Node) NodeIDs() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
 	return n.nodeIDs
 }
 
@@ -71,39 +93,112 @@ func (n *Node) Handle(typ string, fn HandlerFunc) {
 	n.handlers[typ] = fn
 }
 
+// HandleFallback registers a handler for messages of types that have no
+// handler registered with Handle. Its errors are replied like those of any
+// handler. Without one, such requests are answered with a NotSupported error.
+// Will panic if registering multiple fallback handlers.
+func (n *Node) HandleFallback(fn HandlerFunc) {
+	if n.fallback != nil {
+		panic("duplicate fallback message handler")
+	}
+	n.fallback = fn
+}
+
+// Context returns a context that is cancelled once Run stops reading
+// messages, when STDIN is closed or fails. Handlers and background tasks can
+// use it to learn that the node is stopping.
+func (n *Node) Context() context.Context {
+	return n.ctx
+}
+
+// Go runs fn in a new goroutine with the node's context. Run waits for fn to
+// return before returning, so fn should return once the context is done.
+func (n *Node) Go(fn func(ctx context.Context)) {
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		fn(n.ctx)
+	}()
+}
+
+// Every calls fn every interval in a background task started with Go, until
+// the node's context is done or the returned stop function is called. fn is
+// passed a context that is done in either case. Calling stop waits for a call
+// of fn in progress to return, so it must not be called from fn.
+func (n *Node) Every(interval time.Duration, fn func(ctx context.Context)) (stop func()) {
+	ctx, cancel := context.WithCancel(n.ctx)
+	done := make(chan struct{})
+	n.Go(func(context.Context) {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
 // Run executes the main event handling loop. It reads in messages from STDIN
 // and delegates them to the appropriate registered handler. This should be
 // the last function executed by main().
+//
+// Lines that are not messages are logged and skipped. Requests with a body
+// that cannot be decoded are answered with a MalformedRequest error, and
+// requests of a type with no handler with a NotSupported error, unless a
+// fallback handler is registered; both are only logged if they have no
+// message ID to reply to. Run only returns an error if reading STDIN fails,
+// including if a line is longer than maxMessageSize.
+//
+// Once STDIN is closed, Run cancels the node's context and waits for the
+// in-flight handlers and the tasks started with Go or Every to return.
 func (n *Node) Run() error {
+	defer n.cancel()
+
 	scanner := bufio.NewScanner(n.Stdin)
+	scanner.Buffer(nil, maxMessageSize)
 	for scanner.Scan() {
 		line := scanner.Bytes()
 
 		// Parse next line from STDIN as a JSON-formatted message.
 		var msg Message
 		if err := json.Unmarshal(line, &msg); err != nil {
-			return fmt.Errorf("unmarshal message: %w", err)
+			log.Printf("Ignoring malformed message %q: %s", line, err)
+			continue
 		}
 
+		// The message ID is decoded even if other fields are malformed, so
+		// the sender can be told what is wrong.
 		var body MessageBody
 		if err := json.Unmarshal(msg.Body, &body); err != nil {
-			return fmt.Errorf("unmarshal message body: %w", err)
+			n.rejectMessage(msg, body.MsgID, NewRPCError(MalformedRequest, fmt.Sprintf("unmarshal message body: %s", err)))
+			continue
 		}
 		log.Printf("Received %s", msg)
 
 		// What handler should we use for this message?
 		if body.InReplyTo != 0 {
 			// Extract callback, if replying to a previous message.
-			n.mu.Lock()
-			h := n.callbacks[body.InReplyTo]
-			delete(n.callbacks, body.InReplyTo)
-			n.mu.Unlock()
+			cb := n.removeCallback(body.InReplyTo)
 
-			// If no callback exists, just log a message and skip.
-			if h == nil {
+			// If no callback exists, just log a message and skip. The request
+			// may have been cancelled or timed out.
+			if cb == nil {
 				log.Printf("Ignoring reply to %d with no callback", body.InReplyTo)
 				continue
 			}
+			n.stopTimer(cb)
+			h := cb.handler
 
 			// Handle callback in a separate goroutine.
 			n.wg.Add(1)
@@ -119,7 +214,10 @@ func (n *Node) Run() error {
 		if body.Type == "init" {
 			h = n.handleInitMessage // wraps init message with special handling.
 		} else if h = n.handlers[body.Type]; h == nil {
-			return fmt.Errorf("No handler for %s", line)
+			if h = n.fallback; h == nil {
+				n.rejectMessage(msg, body.MsgID, NewRPCError(NotSupported, fmt.Sprintf("no handler for %q message type", body.Type)))
+				continue
+			}
 		}
 
 		// Handle message in a separate goroutine.
@@ -133,12 +231,27 @@ func (n *Node) Run() error {
 		return err
 	}
 
-	// Wait for all in-flight handlers to complete.
+	// Signal background tasks to stop, then wait for all in-flight handlers
+	// and tasks to complete.
+	n.cancel()
 	n.wg.Wait()
 
 	return nil
 }
 
+// rejectMessage replies to a message that cannot be handled with err, or
+// logs err if the message has no ID to reply to.
+func (n *Node) rejectMessage(msg Message, msgID int, err *RPCError) {
+	if msgID == 0 {
+		log.Printf("Ignoring message %s: %s", msg, err)
+		return
+	}
+	log.Printf("Rejecting message %s: %s", msg, err)
+	if err := n.reply(msg.Src, msgID, err); err != nil {
+		log.Printf("reply error: %s", err)
+	}
+}
+
 // handleCallback sends msg response to a callback function. Logs error, if one occurs.
 func (n *Node) handleCallback(h HandlerFunc, msg Message) {
 	if err := h(msg); err != nil {
@@ -178,7 +291,7 @@ func (n *Node) handleInitMessage(msg Message) error {
 	}
 
 	// Send back a response that the node has been initialized.
-	log.Printf("Node %s initialized", n.id)
+	log.Printf("Node %s initialized", n.ID())
 	return n.Reply(msg, MessageBody{Type: "init_ok"})
 }
 
@@ -189,7 +302,11 @@ func (n *Node) Reply(req Message, body any) error {
 	if err := json.Unmarshal(req.Body, &reqBody); err != nil {
 		return err
 	}
+	return n.reply(req.Src, reqBody.MsgID, body)
+}
 
+// reply sends body to dest in reply to the message with ID msgID.
+func (n *Node) reply(dest string, msgID int, body any) error {
 	// We have to marshal/unmarshal to inject our reply message ID.
 	b := make(map[string]any)
 	if buf, err := json.Marshal(body); err != nil {
@@ -197,9 +314,9 @@ func (n *Node) Reply(req Message, body any) error {
 	} else if err := json.Unmarshal(buf, &b); err != nil {
 		return err
 	}
-	b["in_reply_to"] = reqBody.MsgID
+	b["in_reply_to"] = msgID
 
-	return n.Send(req.Src, b)
+	return n.Send(dest, b)
 }
 
 // Send sends a message body to a given destination node.
@@ -210,7 +327,7 @@ func (n *Node) Send(dest string, body any) error {
 	}
 
 	buf, err := json.Marshal(Message{
-		Src:  n.id,
+		Src:  n.ID(),
 		Dest: dest,
 		Body: bodyJSON,
 	})
@@ -218,9 +335,10 @@ func (n *Node) Send(dest string, body any) error {
 		return err
 	}
 
-	// Synchronize access to STDOUT.
-	n.mu.Lock()
-	defer n.mu.Unlock()
+	// Synchronize access to STDOUT. A separate lock is used so that a
+	// blocked write does not hold up the rest of the node.
+	n.outMu.Lock()
+	defer n.outMu.Unlock()
 
 	log.Printf("Sent %s", buf)
 
@@ -233,43 +351,121 @@ func (n *Node) Send(dest string, body any) error {
 
 // RPC sends an async RPC request. Handler invoked when response message received.
 func (n *Node) RPC(dest string, body any, handler HandlerFunc) error {
+	_, err := n.rpc(dest, body, handler, 0)
+	return err
+}
+
+// RPCWithTimeout sends an async RPC request like RPC, but if no response is
+// received within timeout, handler is invoked with a Timeout error message
+// instead and a late response is ignored. Run waits for handler to be invoked
+// either way.
+func (n *Node) RPCWithTimeout(dest string, body any, timeout time.Duration, handler HandlerFunc) error {
+	_, err := n.rpc(dest, body, handler, timeout)
+	return err
+}
+
+// rpc sends a request and registers handler for its response. If timeout is
+// positive, handler is invoked with a Timeout error if no response arrives
+// in time. Returns the message ID of the request.
+func (n *Node) rpc(dest string, body any, handler HandlerFunc, timeout time.Duration) (int, error) {
+	// We have to marshal/unmarshal to inject our message ID.
+	b := make(map[string]any)
+	if buf, err := json.Marshal(body); err != nil {
+		return 0, err
+	} else if err := json.Unmarshal(buf, &b); err != nil {
+		return 0, err
+	}
+
 	n.mu.Lock()
 
 	// Generate a unique message ID.
 	n.nextMsgID++
 	msgID := n.nextMsgID
 
-	// Register a handler for our callback.
-	n.callbacks[msgID] = handler
+	// Register a handler for our callback. The timer is started with the lock
+	// held so that a response cannot be handled before it exists.
+	cb := &callback{handler: handler}
+	if timeout > 0 {
+		n.wg.Add(1) // done once the handler is no longer pending
+		cb.timer = time.AfterFunc(timeout, func() { n.timeout(dest, msgID) })
+	}
+	n.callbacks[msgID] = cb
 
 	n.mu.Unlock()
 
-	// We have to marshal/unmarshal to inject our message ID.
-	b := make(map[string]any)
-	if buf, err := json.Marshal(body); err != nil {
-		return err
-	} else if err := json.Unmarshal(buf, &b); err != nil {
-		return err
-	}
 	b["msg_id"] = msgID
+	if err := n.Send(dest, b); err != nil {
+		if cb := n.removeCallback(msgID); cb != nil {
+			n.stopTimer(cb)
+		}
+		return 0, err
+	}
+	return msgID, nil
+}
 
-	return n.Send(dest, b)
+// removeCallback unregisters and returns the callback for the request msgID.
+// Returns nil if the request has no callback, because a response was already
+// received or the request was cancelled or timed out.
+func (n *Node) removeCallback(msgID int) *callback {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	cb := n.callbacks[msgID]
+	delete(n.callbacks, msgID)
+	return cb
+}
+
+// stopTimer cancels the timeout of an unregistered callback, if any.
+func (n *Node) stopTimer(cb *callback) {
+	if cb.timer != nil && cb.timer.Stop() {
+		n.wg.Done()
+	}
+}
+
+// timeout invokes the handler of the request msgID with a Timeout error
+// message, unless a response has been received in the meantime.
+func (n *Node) timeout(dest string, msgID int) {
+	defer n.wg.Done()
+
+	cb := n.removeCallback(msgID)
+	if cb == nil {
+		return // the response won the race against the timer
+	}
+
+	body, err := json.Marshal(timeoutMessageBody{
+		rpcErrorJSON: rpcErrorJSON{
+			Type: "error",
+			Code: Timeout,
+			Text: fmt.Sprintf("no response from %s to message %d", dest, msgID),
+		},
+		InReplyTo: msgID,
+	})
+	if err != nil {
+		log.Printf("callback error: %s", err)
+		return
+	}
+	n.handleCallback(cb.handler, Message{Src: dest, Dest: n.ID(), Body: body})
 }
 
 // SyncRPC sends a synchronous RPC request. Returns the response message. RPC
 // errors in the message body are converted to *RPCError and are returned.
+// If ctx is done first, the request is forgotten and a late response is
+// ignored.
 func (n *Node) SyncRPC(ctx context.Context, dest string, body any) (Message, error) {
-	respCh := make(chan Message)
-	if err := n.RPC(dest, body, func(m Message) error {
+	// Buffered so that the callback never blocks, even if the context is done
+	// just as the response arrives.
+	respCh := make(chan Message, 1)
+	msgID, err := n.rpc(dest, body, func(m Message) error {
 		respCh <- m
 		return nil
-	}); err != nil {
+	}, 0)
+	if err != nil {
 		return Message{}, err
 	}
 
 	// Wait for either the context to finish or for the response message to arrive.
 	select {
 	case <-ctx.Done():
+		n.removeCallback(msgID)
 		return Message{}, ctx.Err()
 
 	case m := <-respCh:
@@ -280,6 +476,19 @@ func (n *Node) SyncRPC(ctx context.Context, dest string, body any) (Message, err
 	}
 }
 
+// callback is the handler registered for the response to a request.
+type callback struct {
+	handler HandlerFunc
+	timer   *time.Timer // invokes the handler with a Timeout error, if set
+}
+
+// timeoutMessageBody is the body of the message passed to the handler of a
+// request that timed out.
+type timeoutMessageBody struct {
+	rpcErrorJSON
+	InReplyTo int `json:"in_reply_to"`
+}
+
 // Message represents a message sent from Src node to Dest node.
 // The body is stored as unparsed JSON so the handler can parse it itself.
 type Message struct {
@@ -304,8 +513,8 @@ func (m *Message) RPCError() *RPCError {
 	var body MessageBody
 	if err := json.Unmarshal(m.Body, &body); err != nil {
 		return NewRPCError(Crash, err.Error())
-	} else if body.Code == 0 {
-		return nil // no error
+	} else if body.Type != "error" && body.Code == 0 {
+		return nil // no error; a Timeout error has code 0
 	}
 	return NewRPCError(body.Code, body.Text)
 }
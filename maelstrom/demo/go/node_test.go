@@ -17,23 +17,90 @@ import (
 )
 
 func TestNode_Run(t *testing.T) {
-	t.Run("ErrMalformedInputJSON", func(t *testing.T) {
+	t.Run("MalformedInputJSON", func(t *testing.T) {
 		var stdout bytes.Buffer
 		n := maelstrom.NewNode()
-		n.Stdin = strings.NewReader("\n")
+		n.Stdin = strings.NewReader("\n" + `{"dest":"n1", "body":{"type":"foo", "msg_id":1}}` + "\n")
 		n.Stdout = &stdout
-		if err := n.Run(); err == nil || err.Error() != `unmarshal message: unexpected end of JSON input` {
-			t.Fatalf("unexpected error: %v", err)
+		n.Handle("foo", func(msg maelstrom.Message) error {
+			return n.Reply(msg, maelstrom.MessageBody{Type: "foo_ok"})
+		})
+		if err := n.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := stdout.String(), `{"body":{"in_reply_to":1,"type":"foo_ok"}}`+"\n"; got != want {
+			t.Fatalf("stdout=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("MalformedBody", func(t *testing.T) {
+		var stdout bytes.Buffer
+		n := maelstrom.NewNode()
+		n.Stdin = strings.NewReader(`{"src":"c1", "dest":"n1", "body":{"type":"foo", "msg_id":1, "in_reply_to":"x"}}` + "\n" +
+			`{"src":"c1", "dest":"n1", "body":{"type":1}}` + "\n")
+		n.Stdout = &stdout
+		n.Handle("foo", func(msg maelstrom.Message) error {
+			t.Fatal("unexpected call to handler")
+			return nil
+		})
+		if err := n.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := stdout.String(), `{"dest":"c1","body":{"code":12,"in_reply_to":1,"text":"unmarshal message body: json: cannot unmarshal string into Go struct field MessageBody.in_reply_to of type int","type":"error"}}`+"\n"; got != want {
+			t.Fatalf("stdout=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("MissingHandler", func(t *testing.T) {
+		var stdout bytes.Buffer
+		n := maelstrom.NewNode()
+		n.Stdin = strings.NewReader(`{"dest":"n1", "body":{"type":"echo", "msg_id":1}}` + "\n" +
+			`{"dest":"n1", "body":{"type":"gossip"}}` + "\n")
+		n.Stdout = &stdout
+		if err := n.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := stdout.String(), `{"body":{"code":10,"in_reply_to":1,"text":"no handler for \"echo\" message type","type":"error"}}`+"\n"; got != want {
+			t.Fatalf("stdout=%s, want %s", got, want)
 		}
 	})
 
-	t.Run("ErrMissingHandler", func(t *testing.T) {
+	t.Run("Fallback", func(t *testing.T) {
 		var stdout bytes.Buffer
 		n := maelstrom.NewNode()
 		n.Stdin = strings.NewReader(`{"dest":"n1", "body":{"type":"echo", "msg_id":1}}` + "\n")
 		n.Stdout = &stdout
-		if err := n.Run(); err == nil || err.Error() != `No handler for {"dest":"n1", "body":{"type":"echo", "msg_id":1}}` {
-			t.Fatalf("unexpected error: %v", err)
+		n.HandleFallback(func(msg maelstrom.Message) error {
+			return maelstrom.NewRPCError(maelstrom.PreconditionFailed, "fallback")
+		})
+		if err := n.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := stdout.String(), `{"body":{"code":22,"in_reply_to":1,"text":"fallback","type":"error"}}`+"\n"; got != want {
+			t.Fatalf("stdout=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("LongLine", func(t *testing.T) {
+		var stdout bytes.Buffer
+		n := maelstrom.NewNode()
+		value := strings.Repeat("x", 1<<20)
+		n.Stdin = strings.NewReader(`{"dest":"n1", "body":{"type":"foo", "msg_id":1, "value":"` + value + `"}}` + "\n")
+		n.Stdout = &stdout
+		n.Handle("foo", func(msg maelstrom.Message) error {
+			var body struct {
+				Value string `json:"value"`
+			}
+			if err := json.Unmarshal(msg.Body, &body); err != nil {
+				return err
+			}
+			return n.Reply(msg, map[string]any{"type": "foo_ok", "length": len(body.Value)})
+		})
+		if err := n.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := stdout.String(), `{"body":{"in_reply_to":1,"length":1048576,"type":"foo_ok"}}`+"\n"; got != want {
+			t.Fatalf("stdout=%s, want %s", got, want)
 		}
 	})
 
@@ -203,6 +270,86 @@ func TestNode_RPC(t *testing.T) {
 		}
 	})
 
+	t.Run("Timeout", func(t *testing.T) {
+		n, stdin, stdout := newNode(t)
+		initNode(t, n, "n1", []string{"n1", "n2"}, stdin, stdout)
+
+		// Send RPC call and never respond in time.
+		respCh := make(chan maelstrom.Message, 2)
+		errorCh := make(chan error, 1)
+		go func() {
+			errorCh <- n.RPCWithTimeout("n2", map[string]any{"type": "foo"}, 50*time.Millisecond, func(msg maelstrom.Message) error {
+				respCh <- msg
+				return nil
+			})
+		}()
+		if _, err := stdout.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		} else if err := <-errorCh; err != nil {
+			t.Fatal(err)
+		}
+
+		// Ensure the handler is invoked with a timeout error.
+		select {
+		case msg := <-respCh:
+			if got, want := msg.Src, "n2"; got != want {
+				t.Fatalf("Src=%s, want %s", got, want)
+			}
+			if err := msg.RPCError(); err == nil || err.Code != maelstrom.Timeout {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for RPC timeout")
+		}
+
+		// Ensure a late response is ignored.
+		if _, err := stdin.Write([]byte(`{"src":"n2", "dest":"n1", "body":{"type":"foo_ok", "msg_id":2, "in_reply_to":1}}` + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case msg := <-respCh:
+			t.Fatalf("unexpected response: %s", msg.Body)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("ResponseBeforeTimeout", func(t *testing.T) {
+		n, stdin, stdout := newNode(t)
+		initNode(t, n, "n1", []string{"n1", "n2"}, stdin, stdout)
+
+		respCh := make(chan maelstrom.Message, 2)
+		errorCh := make(chan error, 1)
+		go func() {
+			errorCh <- n.RPCWithTimeout("n2", map[string]any{"type": "foo"}, 50*time.Millisecond, func(msg maelstrom.Message) error {
+				respCh <- msg
+				return nil
+			})
+		}()
+		if _, err := stdout.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		} else if err := <-errorCh; err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stdin.Write([]byte(`{"src":"n2", "dest":"n1", "body":{"type":"foo_ok", "msg_id":2, "in_reply_to":1}}` + "\n")); err != nil {
+			t.Fatal(err)
+		}
+
+		// Ensure the handler is invoked with the response, and only once.
+		select {
+		case msg := <-respCh:
+			if err := msg.RPCError(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for RPC response")
+		}
+		select {
+		case msg := <-respCh:
+			t.Fatalf("unexpected second invocation: %s", msg.Body)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
 	t.Run("SkipMissingCallback", func(t *testing.T) {
 		n, stdin, stdout := newNode(t)
 		initNode(t, n, "n1", []string{"n1", "n2"}, stdin, stdout)
@@ -293,6 +440,31 @@ func TestNode_SyncRPC(t *testing.T) {
 		}
 	})
 
+	t.Run("IgnoreLateResponse", func(t *testing.T) {
+		n, stdin, stdout := newNode(t)
+		initNode(t, n, "n1", []string{"n1", "n2"}, stdin, stdout)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errorCh := make(chan error)
+		go func() {
+			_, err := n.SyncRPC(ctx, "n2", map[string]any{"type": "foo"})
+			errorCh <- err
+		}()
+		if _, err := stdout.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		if err := <-errorCh; !errors.Is(err, context.Canceled) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// A response after cancellation must not block the node, which would
+		// stop it from shutting down at the end of the test.
+		if _, err := stdin.Write([]byte(`{"src":"n2", "dest":"n1", "body":{"type":"foo_ok", "msg_id":2, "in_reply_to":1}}` + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	})
+
 	t.Run("RPCError", func(t *testing.T) {
 		n, stdin, stdout := newNode(t)
 		initNode(t, n, "n1", []string{"n1", "n2"}, stdin, stdout)
@@ -333,6 +505,108 @@ func TestNode_SyncRPC(t *testing.T) {
 	})
 }
 
+// Ensure closing STDIN cancels the node's context and that Run waits for
+// background tasks to return.
+func TestNode_Go(t *testing.T) {
+	inr, inw := io.Pipe()
+	n := maelstrom.NewNode()
+	n.Stdin = inr
+	n.Stdout = io.Discard
+
+	stopped := make(chan struct{})
+	n.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		close(stopped)
+	})
+
+	done := make(chan error)
+	go func() { done <- n.Run() }()
+
+	if err := n.Context().Err(); err != nil {
+		t.Fatalf("unexpected context error: %v", err)
+	} else if err := inw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for node to stop")
+	}
+
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("Run returned before background task")
+	}
+	if err := n.Context().Err(); err != context.Canceled {
+		t.Fatalf("unexpected context error: %v", err)
+	}
+}
+
+func TestNode_Every(t *testing.T) {
+	t.Run("Stop", func(t *testing.T) {
+		n, _, _ := newNode(t)
+
+		ticks := make(chan struct{}, 100)
+		stop := n.Every(time.Millisecond, func(ctx context.Context) {
+			ticks <- struct{}{}
+		})
+		for i := 0; i < 3; i++ {
+			select {
+			case <-ticks:
+			case <-time.After(5 * time.Second):
+				t.Fatal("timeout waiting for tick")
+			}
+		}
+
+		stop()
+		for len(ticks) > 0 {
+			<-ticks
+		}
+		time.Sleep(10 * time.Millisecond)
+		if len(ticks) != 0 {
+			t.Fatal("unexpected tick after stop")
+		}
+	})
+
+	// Ensure the task stops with the node without calling stop.
+	t.Run("EOF", func(t *testing.T) {
+		inr, inw := io.Pipe()
+		n := maelstrom.NewNode()
+		n.Stdin = inr
+		n.Stdout = io.Discard
+
+		var ticked bool
+		n.Every(time.Millisecond, func(ctx context.Context) {
+			ticked = true
+			<-ctx.Done()
+		})
+
+		done := make(chan error)
+		go func() { done <- n.Run() }()
+		time.Sleep(10 * time.Millisecond)
+		if err := inw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			} else if !ticked {
+				t.Fatal("expected tick")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for node to stop")
+		}
+	})
+}
+
 // newNode initializes a test node and returns streams to read/write messages.
 func newNode(tb testing.TB) (node *maelstrom.Node, stdin io.Writer, stdout *bufio.Reader) {
 	inr, inw := io.Pipe()
@@ -0,0 +1,138 @@
+package maelstrom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RetryPolicy describes how a failed request is retried. Errors such as
+// Timeout and Crash are indefinite: the request may have taken effect even
+// though it failed, so only idempotent requests are safe to retry on them.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first.
+	// Requests are not retried if it is less than 2.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry. It doubles after every
+	// retry up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// AttemptTimeout bounds every attempt, in addition to the deadline of the
+	// context of the request. An attempt that runs out of time fails with a
+	// Timeout error. Zero means no bound.
+	AttemptTimeout time.Duration
+
+	// Retryable reports whether an attempt that failed with err should be
+	// retried. If nil, Retryable is used.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy returns a policy making up to 5 attempts of a second
+// each, starting 50ms apart.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		Backoff:        50 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		AttemptTimeout: time.Second,
+	}
+}
+
+// Retryable reports whether err is an RPC error that may not recur if the
+// request is retried: Timeout, TemporarilyUnavailable or Crash. Of these, only
+// TemporarilyUnavailable is definite, so requests that are not idempotent
+// should use RetryDefinite instead.
+func Retryable(err error) bool {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	switch rpcErr.Code {
+	case Timeout, TemporarilyUnavailable, Crash:
+		return true
+	default:
+		return false
+	}
+}
+
+// RetryDefinite reports whether err is retryable, see Retryable, and
+// definite, see Definite. It can be used as the Retryable function of a
+// RetryPolicy for requests that must not take effect twice.
+func RetryDefinite(err error) bool {
+	return Retryable(err) && Definite(err)
+}
+
+// Definite reports whether err is an RPC error guaranteeing that the request
+// had no effect. Timeouts and crashes, custom errors, and errors other than
+// RPC errors are indefinite: the request may or may not have taken effect.
+func Definite(err error) bool {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	switch rpcErr.Code {
+	case Timeout, Crash:
+		return false
+	default:
+		return rpcErr.Code < 1000 // codes above 1000 are custom and may be indefinite
+	}
+}
+
+// Do calls fn until it succeeds, returns an error that is not retryable, or
+// runs out of attempts, and returns the last error. It gives up early if ctx
+// is done.
+func (p RetryPolicy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = Retryable
+	}
+
+	backoff := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := p.attempt(ctx, fn)
+		if err == nil || attempt >= p.MaxAttempts || !retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		if backoff *= 2; backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+// attempt calls fn once, bounded by AttemptTimeout.
+func (p RetryPolicy) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if p.AttemptTimeout <= 0 {
+		return fn(ctx)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, p.AttemptTimeout)
+	defer cancel()
+	err := fn(attemptCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		return NewRPCError(Timeout, fmt.Sprintf("no response within %s", p.AttemptTimeout))
+	}
+	return err
+}
+
+// RetryRPC sends a synchronous RPC request like SyncRPC, retrying it
+// according to policy. Returns the last response or error.
+func (n *Node) RetryRPC(ctx context.Context, dest string, body any, policy RetryPolicy) (Message, error) {
+	var resp Message
+	err := policy.Do(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = n.SyncRPC(ctx, dest, body)
+		return err
+	})
+	return resp, err
+}
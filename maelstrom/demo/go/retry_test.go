@@ -0,0 +1,199 @@
+package maelstrom_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+	"github.com/jepsen-io/maelstrom/demo/go/simnet"
+)
+
+func TestRetryPolicy_Do(t *testing.T) {
+	policy := maelstrom.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	t.Run("OK", func(t *testing.T) {
+		var attempts int
+		if err := policy.Do(context.Background(), func(ctx context.Context) error {
+			if attempts++; attempts < 3 {
+				return maelstrom.NewRPCError(maelstrom.TemporarilyUnavailable, "busy")
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		} else if attempts != 3 {
+			t.Fatalf("attempts=%d, want 3", attempts)
+		}
+	})
+
+	t.Run("ErrMaxAttempts", func(t *testing.T) {
+		var attempts int
+		err := policy.Do(context.Background(), func(ctx context.Context) error {
+			attempts++
+			return maelstrom.NewRPCError(maelstrom.Crash, "boom")
+		})
+		if maelstrom.ErrorCode(err) != maelstrom.Crash {
+			t.Fatalf("unexpected error: %v", err)
+		} else if attempts != 3 {
+			t.Fatalf("attempts=%d, want 3", attempts)
+		}
+	})
+
+	t.Run("ErrNotRetryable", func(t *testing.T) {
+		var attempts int
+		err := policy.Do(context.Background(), func(ctx context.Context) error {
+			attempts++
+			return maelstrom.NewRPCError(maelstrom.KeyDoesNotExist, "missing")
+		})
+		if maelstrom.ErrorCode(err) != maelstrom.KeyDoesNotExist {
+			t.Fatalf("unexpected error: %v", err)
+		} else if attempts != 1 {
+			t.Fatalf("attempts=%d, want 1", attempts)
+		}
+	})
+
+	t.Run("CustomRetryable", func(t *testing.T) {
+		policy := policy
+		policy.Retryable = func(err error) bool { return maelstrom.ErrorCode(err) == maelstrom.KeyDoesNotExist }
+
+		var attempts int
+		policy.Do(context.Background(), func(ctx context.Context) error {
+			attempts++
+			return maelstrom.NewRPCError(maelstrom.KeyDoesNotExist, "missing")
+		})
+		if attempts != 3 {
+			t.Fatalf("attempts=%d, want 3", attempts)
+		}
+	})
+
+	t.Run("AttemptTimeout", func(t *testing.T) {
+		policy := policy
+		policy.AttemptTimeout = 10 * time.Millisecond
+
+		var attempts int
+		if err := policy.Do(context.Background(), func(ctx context.Context) error {
+			if attempts++; attempts == 1 {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		} else if attempts != 2 {
+			t.Fatalf("attempts=%d, want 2", attempts)
+		}
+	})
+
+	t.Run("ErrContextDone", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		policy := policy
+		policy.Backoff, policy.MaxBackoff = time.Hour, time.Hour
+
+		var attempts int
+		err := policy.Do(ctx, func(ctx context.Context) error {
+			attempts++
+			cancel()
+			return maelstrom.NewRPCError(maelstrom.Timeout, "timed out")
+		})
+		if maelstrom.ErrorCode(err) != maelstrom.Timeout {
+			t.Fatalf("unexpected error: %v", err)
+		} else if attempts != 1 {
+			t.Fatalf("attempts=%d, want 1", attempts)
+		}
+	})
+}
+
+func TestRetryable(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{maelstrom.NewRPCError(maelstrom.Timeout, ""), true},
+		{maelstrom.NewRPCError(maelstrom.TemporarilyUnavailable, ""), true},
+		{maelstrom.NewRPCError(maelstrom.Crash, ""), true},
+		{maelstrom.NewRPCError(maelstrom.PreconditionFailed, ""), false},
+		{context.Canceled, false},
+		{errors.New("eof"), false},
+	} {
+		if got := maelstrom.Retryable(tt.err); got != tt.want {
+			t.Errorf("Retryable(%v)=%v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDefinite(t *testing.T) {
+	for _, tt := range []struct {
+		err                 error
+		definite, retryable bool
+	}{
+		{maelstrom.NewRPCError(maelstrom.TemporarilyUnavailable, ""), true, true},
+		{maelstrom.NewRPCError(maelstrom.KeyDoesNotExist, ""), true, false},
+		{maelstrom.NewRPCError(maelstrom.PreconditionFailed, ""), true, false},
+		{maelstrom.NewRPCError(maelstrom.Timeout, ""), false, false},
+		{maelstrom.NewRPCError(maelstrom.Crash, ""), false, false},
+		{maelstrom.NewRPCError(1000, ""), false, false},
+		{context.DeadlineExceeded, false, false},
+		{errors.New("eof"), false, false},
+	} {
+		if got := maelstrom.Definite(tt.err); got != tt.definite {
+			t.Errorf("Definite(%v)=%v, want %v", tt.err, got, tt.definite)
+		}
+		if got := maelstrom.RetryDefinite(tt.err); got != tt.retryable {
+			t.Errorf("RetryDefinite(%v)=%v, want %v", tt.err, got, tt.retryable)
+		}
+	}
+}
+
+// Ensure a KV client with a retry policy retries failed requests.
+func TestKV_WithRetry(t *testing.T) {
+	net := simnet.New(simnet.Config{})
+	kv := net.Service(maelstrom.LinKV)
+
+	// The store is unavailable for the first request and drops the second.
+	var mu sync.Mutex
+	var requests int
+	kv.Handle("read", func(msg maelstrom.Message) error {
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+
+		switch n {
+		case 1:
+			return maelstrom.NewRPCError(maelstrom.TemporarilyUnavailable, "busy")
+		case 2:
+			return nil // no reply
+		default:
+			return kv.Reply(msg, map[string]any{"type": "read_ok", "value": 5})
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := net.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer net.Close()
+
+	client := maelstrom.NewLinKV(net.Client("c1"))
+	if _, err := client.Read(ctx, "x"); maelstrom.ErrorCode(err) != maelstrom.TemporarilyUnavailable {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	requests = 0
+	mu.Unlock()
+	v, err := client.WithRetry(maelstrom.RetryPolicy{
+		MaxAttempts:    3,
+		Backoff:        time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		AttemptTimeout: 50 * time.Millisecond,
+	}).ReadInt(ctx, "x")
+	if err != nil {
+		t.Fatal(err)
+	} else if v != 5 {
+		t.Fatalf("value=%d, want 5", v)
+	}
+}
@@ -88,6 +88,6 @@ func (e *RPCError) MarshalJSON() ([]byte, error) {
 // rpcErrorJSON is a struct for marshaling an RPCError to JSON.
 type rpcErrorJSON struct {
 	Type string `json:"type,omitempty"`
-	Code int    `json:"code,omitempty"`
+	Code int    `json:"code"` // Timeout is 0
 	Text string `json:"text,omitempty"`
 }
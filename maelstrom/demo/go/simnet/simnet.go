@@ -0,0 +1,492 @@
+// Package simnet runs clusters of maelstrom.Node in a single process over a
+// simulated network, so that protocols can be unit tested without Maelstrom.
+//
+// A Network connects nodes through in-memory pipes and routes every message
+// a node writes to the node named by its "dest". Messages between cluster
+// nodes can be delayed, dropped, duplicated and cut off by partitions.
+// Messages to and from clients and services, such as a stand-in for one of
+// Maelstrom's key/value services, are only delayed, like Maelstrom's client
+// links.
+//
+// Fault injection is seeded: whether a message is dropped or duplicated, and
+// how long it is delayed, is drawn from a random source seeded with the
+// network seed, the message itself and the number of messages sent before it
+// over the same link. The same message therefore meets the same fate in
+// every run, whatever the order in which different nodes happen to send, and
+// a message that is sent again unchanged gets a fate of its own.
+//
+// Scheduling is not: messages are delivered once their latency has elapsed
+// in real time, and nodes handle them concurrently, so the order in which
+// messages are sent, and therefore delivered, depends on the Go scheduler
+// like it would on a real network. A run is only reproducible to the extent
+// that the nodes' behaviour does not depend on that order.
+package simnet
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// initClient is the client that sends the "init" messages.
+const initClient = "simnet"
+
+// Config holds the faults a Network injects.
+type Config struct {
+	// Seed seeds the random source that decides the fate of every message:
+	// whether it is dropped or duplicated, and its latency. It does not
+	// decide the order in which nodes send messages, which depends on how
+	// their goroutines are scheduled.
+	Seed int64
+
+	// Every message is delayed by a random duration between MinLatency and
+	// MaxLatency.
+	MinLatency time.Duration
+	MaxLatency time.Duration
+
+	// DropRate is the probability that a message between cluster nodes is
+	// lost, and DuplicateRate the probability that it is delivered twice.
+	DropRate      float64
+	DuplicateRate float64
+}
+
+// Stats counts the messages a Network has handled.
+type Stats struct {
+	Sent       int // messages written by nodes, services and clients
+	Delivered  int // messages delivered, including duplicates
+	Dropped    int // messages lost to DropRate
+	Duplicated int // extra copies delivered because of DuplicateRate
+	Cut        int // messages lost to a partition
+}
+
+// Network is a simulated network of cluster nodes, services and clients.
+type Network struct {
+	config Config
+
+	mu        sync.Mutex
+	endpoints map[string]*endpoint
+	nodeIDs   []string // cluster nodes, in the order they were added
+	services  []string // services, in the order they were added
+	started   bool
+	closed    bool
+	groups    map[string]int // partition group of each node, nil if healed
+	queue     messageQueue
+	seq       int
+	sends     map[link]int // messages sent over each link so far
+	stats     Stats
+
+	wake chan struct{} // signals the scheduler that the queue changed
+	done chan struct{} // closed by Close
+	wg   sync.WaitGroup
+}
+
+// link is a direction between two endpoints.
+type link struct {
+	src, dest string
+}
+
+// endpoint is a node, service or client attached to the network.
+type endpoint struct {
+	node   *maelstrom.Node
+	kind   kind
+	stdin  *io.PipeWriter
+	runErr chan error // receives the result of the node's Run
+}
+
+// kind is the role of an endpoint.
+type kind int
+
+const (
+	member  kind = iota // cluster node
+	service             // reachable by every endpoint, but not in the cluster
+	client              // sends requests to the cluster
+)
+
+// New returns an empty network injecting the faults in config.
+func New(config Config) *Network {
+	if config.MaxLatency < config.MinLatency {
+		config.MaxLatency = config.MinLatency
+	}
+	return &Network{
+		config:    config,
+		endpoints: make(map[string]*endpoint),
+		sends:     make(map[link]int),
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+}
+
+// Node returns a new cluster node with the given ID. Register its handlers
+// before calling Start, which initializes every node.
+func (net *Network) Node(id string) *maelstrom.Node {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	if net.started {
+		panic("simnet: Node called after Start")
+	}
+	net.nodeIDs = append(net.nodeIDs, id)
+	return net.attach(id, member)
+}
+
+// Service returns a new service with the given ID, such as a stand-in for
+// one of Maelstrom's key/value services. Like Maelstrom's services, it can be
+// reached by every node and client, but it is not a cluster member: it is
+// not in the node IDs of the cluster and receives no "init" message.
+// Register its handlers before calling Start, which runs it.
+func (net *Network) Service(id string) *maelstrom.Node {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	if net.started {
+		panic("simnet: Service called after Start")
+	}
+	net.services = append(net.services, id)
+	n := net.attach(id, service)
+	n.Init(id, nil)
+	return n
+}
+
+// Client returns a new running client with the given ID, to send requests to
+// the cluster with RPC or SyncRPC once the network is started.
+func (net *Network) Client(id string) *maelstrom.Node {
+	net.mu.Lock()
+	n := net.attach(id, client)
+	net.mu.Unlock()
+
+	n.Init(id, nil)
+	net.run(id)
+	return n
+}
+
+// attach creates a node connected to the network. Must be called with the
+// lock held.
+func (net *Network) attach(id string, kind kind) *maelstrom.Node {
+	if _, ok := net.endpoints[id]; ok {
+		panic(fmt.Sprintf("simnet: duplicate node %q", id))
+	}
+
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	n := maelstrom.NewNode()
+	n.Stdin, n.Stdout = stdinR, stdoutW
+	net.endpoints[id] = &endpoint{
+		node:   n,
+		kind:   kind,
+		stdin:  stdinW,
+		runErr: make(chan error, 1),
+	}
+
+	net.wg.Add(1)
+	go func() {
+		defer net.wg.Done()
+		net.read(id, stdoutR)
+	}()
+	return n
+}
+
+// run starts the message loop of the node with the given ID.
+func (net *Network) run(id string) {
+	net.mu.Lock()
+	e := net.endpoints[id]
+	net.mu.Unlock()
+
+	go func() {
+		err := e.node.Run()
+		// Fail further deliveries rather than block the scheduler.
+		e.node.Stdin.(*io.PipeReader).CloseWithError(errors.New("simnet: node stopped"))
+		e.node.Stdout.(*io.PipeWriter).Close()
+		e.runErr <- err
+	}()
+}
+
+// Start runs every cluster node and service, sends each cluster node an
+// "init" message, and returns once every node has replied.
+func (net *Network) Start(ctx context.Context) error {
+	net.mu.Lock()
+	if net.started {
+		net.mu.Unlock()
+		return errors.New("simnet: already started")
+	}
+	net.started = true
+	nodeIDs := append([]string(nil), net.nodeIDs...)
+	services := append([]string(nil), net.services...)
+	net.mu.Unlock()
+
+	net.wg.Add(1)
+	go func() {
+		defer net.wg.Done()
+		net.schedule()
+	}()
+
+	for _, id := range services {
+		net.run(id)
+	}
+	for _, id := range nodeIDs {
+		net.run(id)
+	}
+
+	client := net.Client(initClient)
+	for _, id := range nodeIDs {
+		if _, err := client.SyncRPC(ctx, id, maelstrom.InitMessageBody{
+			MessageBody: maelstrom.MessageBody{Type: "init"},
+			NodeID:      id,
+			NodeIDs:     nodeIDs,
+		}); err != nil {
+			return fmt.Errorf("init %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Partition splits the cluster nodes into groups. Messages between nodes in
+// different groups, including those already in flight, are dropped until
+// Heal is called. Nodes that are not in any group are cut off from every
+// other node. Clients and services can still reach every node.
+func (net *Network) Partition(groups ...[]string) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+
+	net.groups = make(map[string]int)
+	for i, group := range groups {
+		for _, id := range group {
+			net.groups[id] = i
+		}
+	}
+}
+
+// Heal removes the partition, if any.
+func (net *Network) Heal() {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	net.groups = nil
+}
+
+// Stats returns the number of messages handled so far.
+func (net *Network) Stats() Stats {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	return net.stats
+}
+
+// Close stops delivering messages, closes the input of every node and client
+// and waits for their message loops to return, which requires every handler
+// to return. Returns the first error returned by a message loop.
+func (net *Network) Close() error {
+	net.mu.Lock()
+	if net.closed {
+		net.mu.Unlock()
+		return nil
+	}
+	net.closed = true
+	close(net.done)
+	endpoints := make([]*endpoint, 0, len(net.endpoints))
+	for _, e := range net.endpoints {
+		endpoints = append(endpoints, e)
+	}
+	started := net.started
+	net.mu.Unlock()
+
+	var err error
+	for _, e := range endpoints {
+		e.stdin.Close()
+		if !started && e.kind != client {
+			e.node.Stdout.(*io.PipeWriter).Close() // never ran
+			continue
+		}
+		if runErr := <-e.runErr; runErr != nil && err == nil {
+			err = runErr
+		}
+	}
+	net.wg.Wait()
+	return err
+}
+
+// read routes every message written by the node with the given ID.
+func (net *Network) read(id string, stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, 1<<24)
+	for scanner.Scan() {
+		var msg maelstrom.Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.Printf("simnet: %s wrote malformed message: %s", id, err)
+			continue
+		}
+		net.send(msg)
+	}
+}
+
+// send decides the fate of msg and queues its copies for delivery.
+func (net *Network) send(msg maelstrom.Message) {
+	line := append(mustMarshal(msg), '\n')
+
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	net.stats.Sent++
+
+	l := link{src: msg.Src, dest: msg.Dest}
+	rng := net.rand(msg, net.sends[l])
+	net.sends[l]++
+
+	dest, ok := net.endpoints[msg.Dest]
+	if !ok || net.closed {
+		return
+	}
+	copies := 1
+	if src, ok := net.endpoints[msg.Src]; ok && src.kind == member && dest.kind == member {
+		if rng.Float64() < net.config.DropRate {
+			net.stats.Dropped++
+			return
+		}
+		if rng.Float64() < net.config.DuplicateRate {
+			net.stats.Duplicated++
+			copies = 2
+		}
+	}
+
+	now := time.Now()
+	for i := 0; i < copies; i++ {
+		net.seq++
+		heap.Push(&net.queue, &delivery{
+			at:   now.Add(net.latency(rng)),
+			seq:  net.seq,
+			msg:  msg,
+			line: line,
+		})
+	}
+	select {
+	case net.wake <- struct{}{}:
+	default:
+	}
+}
+
+// rand returns the random source deciding the fate of msg, the message with
+// index i among those sent over its link.
+func (net *Network) rand(msg maelstrom.Message, i int) *rand.Rand {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d\x00%s\x00%s\x00%d\x00%s", net.config.Seed, msg.Src, msg.Dest, i, msg.Body)
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+// latency returns a random delay between MinLatency and MaxLatency.
+func (net *Network) latency(rng *rand.Rand) time.Duration {
+	spread := net.config.MaxLatency - net.config.MinLatency
+	if spread <= 0 {
+		return net.config.MinLatency
+	}
+	return net.config.MinLatency + time.Duration(rng.Int63n(int64(spread)+1))
+}
+
+// schedule delivers queued messages once their latency has elapsed in real
+// time, in order of delivery time, until Close is called. Messages due at
+// the same time are delivered in the order they were sent.
+func (net *Network) schedule() {
+	for {
+		net.mu.Lock()
+		if net.queue.Len() == 0 {
+			net.mu.Unlock()
+			select {
+			case <-net.wake:
+				continue
+			case <-net.done:
+				return
+			}
+		}
+
+		next := net.queue[0]
+		if wait := time.Until(next.at); wait > 0 {
+			net.mu.Unlock()
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-net.wake:
+				timer.Stop()
+			case <-net.done:
+				timer.Stop()
+				return
+			}
+			continue
+		}
+
+		heap.Pop(&net.queue)
+		dest := net.endpoints[next.msg.Dest]
+		if net.cut(next.msg.Src, next.msg.Dest) {
+			net.stats.Cut++
+			net.mu.Unlock()
+			continue
+		}
+		net.stats.Delivered++
+		net.mu.Unlock()
+
+		if _, err := dest.stdin.Write(next.line); err != nil {
+			log.Printf("simnet: deliver to %s: %s", next.msg.Dest, err)
+		}
+	}
+}
+
+// cut reports whether a partition separates src from dest. Only links
+// between cluster nodes can be cut. Must be called with the lock held.
+func (net *Network) cut(src, dest string) bool {
+	if net.groups == nil {
+		return false
+	}
+	s, d := net.endpoints[src], net.endpoints[dest]
+	if s == nil || d == nil || s.kind != member || d.kind != member {
+		return false
+	}
+	sg, ok := net.groups[src]
+	if !ok {
+		return true
+	}
+	dg, ok := net.groups[dest]
+	return !ok || sg != dg
+}
+
+// delivery is a copy of a message waiting to be delivered.
+type delivery struct {
+	at   time.Time
+	seq  int // breaks ties between deliveries due at the same time
+	msg  maelstrom.Message
+	line []byte
+}
+
+// messageQueue is a min-heap of deliveries ordered by delivery time.
+type messageQueue []*delivery
+
+func (q messageQueue) Len() int { return len(q) }
+
+func (q messageQueue) Less(i, j int) bool {
+	if !q[i].at.Equal(q[j].at) {
+		return q[i].at.Before(q[j].at)
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q messageQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *messageQueue) Push(x any) { *q = append(*q, x.(*delivery)) }
+
+func (q *messageQueue) Pop() any {
+	old := *q
+	d := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return d
+}
+
+// mustMarshal encodes a message that was just decoded.
+func mustMarshal(msg maelstrom.Message) []byte {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	return buf
+}
@@ -0,0 +1,271 @@
+package simnet_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+	"github.com/jepsen-io/maelstrom/demo/go/simnet"
+)
+
+func TestNetwork_RPC(t *testing.T) {
+	net := simnet.New(simnet.Config{})
+	n := net.Node("n1")
+	n.Handle("echo", func(msg maelstrom.Message) error {
+		var body map[string]any
+		if err := json.Unmarshal(msg.Body, &body); err != nil {
+			return err
+		}
+		body["type"] = "echo_ok"
+		return n.Reply(msg, body)
+	})
+	start(t, net)
+
+	resp, err := net.Client("c1").SyncRPC(context.Background(), "n1", map[string]any{"type": "echo", "echo": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		t.Fatal(err)
+	} else if body["echo"] != "hello" {
+		t.Fatalf("echo=%v, want hello", body["echo"])
+	}
+	if got := n.NodeIDs(); !reflect.DeepEqual(got, []string{"n1"}) {
+		t.Fatalf("NodeIDs=%v, want [n1]", got)
+	}
+}
+
+// Ensure a service is reachable from every node, even across a partition,
+// without being a member of the cluster.
+func TestNetwork_Service(t *testing.T) {
+	net := simnet.New(simnet.Config{})
+	nodes := cluster(net, "n1", "n2")
+	kv := net.Service(maelstrom.LinKV)
+	kv.Handle("read", func(msg maelstrom.Message) error {
+		return kv.Reply(msg, map[string]any{"type": "read_ok", "value": 1})
+	})
+	start(t, net)
+	net.Partition([]string{"n1"}, []string{"n2"})
+
+	for id, n := range nodes {
+		if _, err := n.SyncRPC(context.Background(), maelstrom.LinKV, maelstrom.MessageBody{Type: "read"}); err != nil {
+			t.Fatalf("read from %s: %s", id, err)
+		}
+		if got := n.NodeIDs(); !reflect.DeepEqual(got, []string{"n1", "n2"}) {
+			t.Fatalf("NodeIDs=%v on %s, want [n1 n2]", got, id)
+		}
+	}
+	if got := kv.NodeIDs(); len(got) != 0 {
+		t.Fatalf("NodeIDs=%v on the service, want none", got)
+	}
+	if got := net.Stats().Cut; got != 0 {
+		t.Fatalf("cut %d messages, want 0", got)
+	}
+}
+
+func TestNetwork_Partition(t *testing.T) {
+	net := simnet.New(simnet.Config{})
+	nodes := cluster(net, "n1", "n2", "n3")
+	received := record(nodes["n2"])
+	start(t, net)
+
+	net.Partition([]string{"n1"}, []string{"n2", "n3"})
+	send(t, nodes["n1"], "n2", 1)
+	send(t, nodes["n3"], "n2", 2)
+	waitFor(t, received, 1)
+	eventually(t, func() bool { return net.Stats().Cut == 1 })
+
+	net.Heal()
+	send(t, nodes["n1"], "n2", 3)
+	waitFor(t, received, 2)
+
+	if got := received.values(); !reflect.DeepEqual(got, []int{2, 3}) {
+		t.Fatalf("received %v, want [2 3]", got)
+	}
+}
+
+func TestNetwork_Drop(t *testing.T) {
+	run := func() []int {
+		net := simnet.New(simnet.Config{Seed: 42, DropRate: 0.5})
+		nodes := cluster(net, "n1", "n2")
+		received := record(nodes["n2"])
+		start(t, net)
+
+		sent := net.Stats().Sent
+		for i := 0; i < 100; i++ {
+			send(t, nodes["n1"], "n2", i)
+		}
+		eventually(t, func() bool { return net.Stats().Sent == sent+100 })
+
+		stats := net.Stats()
+		if stats.Dropped == 0 || stats.Dropped == 100 {
+			t.Fatalf("Dropped=%d, want some but not all", stats.Dropped)
+		}
+		waitFor(t, received, 100-stats.Dropped)
+		return received.values()
+	}
+
+	// The same seed drops the same messages.
+	if a, b := run(), run(); !reflect.DeepEqual(a, b) {
+		t.Fatalf("received %v, then %v", a, b)
+	}
+}
+
+// Ensure a message that is sent again unchanged, such as gossip without a
+// message ID, is not dropped every time.
+func TestNetwork_Drop_Resend(t *testing.T) {
+	run := func() int {
+		net := simnet.New(simnet.Config{Seed: 42, DropRate: 0.5})
+		nodes := cluster(net, "n1", "n2")
+		received := record(nodes["n2"])
+		start(t, net)
+
+		sent := net.Stats().Sent
+		for i := 0; i < 100; i++ {
+			send(t, nodes["n1"], "n2", 7)
+		}
+		eventually(t, func() bool { return net.Stats().Sent == sent+100 })
+
+		stats := net.Stats()
+		if stats.Dropped == 0 || stats.Dropped == 100 {
+			t.Fatalf("Dropped=%d, want some but not all", stats.Dropped)
+		}
+		waitFor(t, received, 100-stats.Dropped)
+		return len(received.values())
+	}
+
+	// The same seed still drops the same copies.
+	if a, b := run(), run(); a != b {
+		t.Fatalf("received %d copies, then %d", a, b)
+	}
+}
+
+func TestNetwork_Duplicate(t *testing.T) {
+	net := simnet.New(simnet.Config{DuplicateRate: 1})
+	nodes := cluster(net, "n1", "n2")
+	received := record(nodes["n2"])
+	start(t, net)
+
+	send(t, nodes["n1"], "n2", 1)
+	send(t, nodes["n1"], "n2", 2)
+	waitFor(t, received, 4)
+
+	if got := received.values(); !reflect.DeepEqual(got, []int{1, 1, 2, 2}) {
+		t.Fatalf("received %v, want [1 1 2 2]", got)
+	}
+}
+
+func TestNetwork_Latency(t *testing.T) {
+	const latency = 20 * time.Millisecond
+	net := simnet.New(simnet.Config{MinLatency: latency, MaxLatency: 2 * latency})
+	n := net.Node("n1")
+	n.Handle("ping", func(msg maelstrom.Message) error {
+		return n.Reply(msg, maelstrom.MessageBody{Type: "pong"})
+	})
+	start(t, net)
+
+	client := net.Client("c1")
+	begin := time.Now()
+	if _, err := client.SyncRPC(context.Background(), "n1", maelstrom.MessageBody{Type: "ping"}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed < 2*latency {
+		t.Fatalf("round trip took %s, want at least %s", elapsed, 2*latency)
+	}
+}
+
+// cluster adds nodes with the given IDs to net.
+func cluster(net *simnet.Network, ids ...string) map[string]*maelstrom.Node {
+	nodes := make(map[string]*maelstrom.Node)
+	for _, id := range ids {
+		nodes[id] = net.Node(id)
+	}
+	return nodes
+}
+
+// start starts net and closes it at the end of the test.
+func start(tb testing.TB, net *simnet.Network) {
+	tb.Helper()
+	tb.Cleanup(func() {
+		if err := net.Close(); err != nil {
+			tb.Error(err)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := net.Start(ctx); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// valueMessageBody is the body of the "value" messages sent between nodes.
+type valueMessageBody struct {
+	maelstrom.MessageBody
+	Value int `json:"value"`
+}
+
+// send sends a "value" message from n to dest.
+func send(tb testing.TB, n *maelstrom.Node, dest string, value int) {
+	tb.Helper()
+	if err := n.Send(dest, valueMessageBody{
+		MessageBody: maelstrom.MessageBody{Type: "value"},
+		Value:       value,
+	}); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// recorder records the "value" messages received by a node.
+type recorder struct {
+	mu       sync.Mutex
+	received []int
+}
+
+// record registers a "value" handler on n that records the messages it
+// receives.
+func record(n *maelstrom.Node) *recorder {
+	r := &recorder{}
+	n.Handle("value", func(msg maelstrom.Message) error {
+		var body valueMessageBody
+		if err := json.Unmarshal(msg.Body, &body); err != nil {
+			return err
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.received = append(r.received, body.Value)
+		return nil
+	})
+	return r
+}
+
+// values returns the values received so far, sorted.
+func (r *recorder) values() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	values := append([]int(nil), r.received...)
+	sort.Ints(values)
+	return values
+}
+
+// waitFor fails the test if r has not received n messages within a second.
+func waitFor(tb testing.TB, r *recorder, n int) {
+	tb.Helper()
+	eventually(tb, func() bool { return len(r.values()) >= n })
+}
+
+// eventually fails the test if cond does not hold within a second.
+func eventually(tb testing.TB, cond func() bool) {
+	tb.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			tb.Fatal("condition not met")
+		}
+	}
+}
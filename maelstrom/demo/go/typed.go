@@ -0,0 +1,45 @@
+package maelstrom
+
+import (
+	"encoding/json"
+)
+
+// TypedHandlerFunc is the function signature for a handler registered with
+// HandleTyped. It receives the message and its body decoded into a Req, and
+// returns the body of the reply.
+type TypedHandlerFunc[Req, Resp any] func(msg Message, req Req) (Resp, error)
+
+// HandleTyped registers a handler for a given message type that decodes
+// message bodies into a Req and replies with the Resp returned by fn. Bodies
+// that cannot be decoded are answered with a MalformedRequest error without
+// calling fn, and errors returned by fn are answered like those of any
+// handler. If the reply has no "type", it is typ followed by "_ok".
+//
+// Messages that are not answered with a reply, such as gossip, should be
+// handled with Handle instead. Will panic if registering multiple handlers
+// for the same message type.
+func HandleTyped[Req, Resp any](n *Node, typ string, fn TypedHandlerFunc[Req, Resp]) {
+	n.Handle(typ, func(msg Message) error {
+		var req Req
+		if err := json.Unmarshal(msg.Body, &req); err != nil {
+			return NewRPCError(MalformedRequest, err.Error())
+		}
+
+		resp, err := fn(msg, req)
+		if err != nil {
+			return err
+		}
+
+		// We have to marshal/unmarshal to default the reply type.
+		b := make(map[string]any)
+		if buf, err := json.Marshal(resp); err != nil {
+			return err
+		} else if err := json.Unmarshal(buf, &b); err != nil {
+			return err
+		}
+		if t, _ := b["type"].(string); t == "" {
+			b["type"] = typ + "_ok"
+		}
+		return n.Reply(msg, b)
+	})
+}
@@ -0,0 +1,74 @@
+package maelstrom_test
+
+import (
+	"testing"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+type sumMessageBody struct {
+	maelstrom.MessageBody
+	Terms []int `json:"terms"`
+}
+
+type sumOKMessageBody struct {
+	maelstrom.MessageBody
+	Sum int `json:"sum"`
+}
+
+// Ensure typed handlers decode requests and reply with their responses.
+func TestHandleTyped(t *testing.T) {
+	n, stdin, stdout := newNode(t)
+	maelstrom.HandleTyped(n, "sum", func(msg maelstrom.Message, req sumMessageBody) (sumOKMessageBody, error) {
+		if len(req.Terms) == 0 {
+			return sumOKMessageBody{}, maelstrom.NewRPCError(maelstrom.PreconditionFailed, "no terms")
+		}
+		var resp sumOKMessageBody
+		for _, term := range req.Terms {
+			resp.Sum += term
+		}
+		return resp, nil
+	})
+	maelstrom.HandleTyped(n, "ping", func(msg maelstrom.Message, req maelstrom.MessageBody) (maelstrom.MessageBody, error) {
+		return maelstrom.MessageBody{Type: "pong"}, nil
+	})
+	initNode(t, n, "n1", []string{"n1"}, stdin, stdout)
+
+	for _, tt := range []struct {
+		name string
+		req  string
+		want string
+	}{
+		{
+			name: "OK",
+			req:  `{"src":"c1", "dest":"n1", "body":{"type":"sum", "msg_id":2, "terms":[1, 2]}}`,
+			want: `{"src":"n1","dest":"c1","body":{"in_reply_to":2,"sum":3,"type":"sum_ok"}}`,
+		},
+		{
+			name: "ExplicitType",
+			req:  `{"src":"c1", "dest":"n1", "body":{"type":"ping", "msg_id":3}}`,
+			want: `{"src":"n1","dest":"c1","body":{"in_reply_to":3,"type":"pong"}}`,
+		},
+		{
+			name: "ErrMalformed",
+			req:  `{"src":"c1", "dest":"n1", "body":{"type":"sum", "msg_id":4, "terms":"1, 2"}}`,
+			want: `{"src":"n1","dest":"c1","body":{"code":12,"in_reply_to":4,"text":"json: cannot unmarshal string into Go struct field sumMessageBody.terms of type []int","type":"error"}}`,
+		},
+		{
+			name: "ErrHandler",
+			req:  `{"src":"c1", "dest":"n1", "body":{"type":"sum", "msg_id":5, "terms":[]}}`,
+			want: `{"src":"n1","dest":"c1","body":{"code":22,"in_reply_to":5,"text":"no terms","type":"error"}}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := stdin.Write([]byte(tt.req + "\n")); err != nil {
+				t.Fatal(err)
+			}
+			if line, err := stdout.ReadString('\n'); err != nil {
+				t.Fatal(err)
+			} else if got, want := line, tt.want+"\n"; got != want {
+				t.Fatalf("response=%s, want %s", got, want)
+			}
+		})
+	}
+}